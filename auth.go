@@ -74,7 +74,9 @@ func NewInMemoryAPITokenStore() *InMemoryAPITokenStore {
 }
 
 func (s *InMemoryAPITokenStore) Get(ctx context.Context) (*APITokenInfo, error) {
-	return s.active.Load().(*APITokenInfo), nil
+	// Nothing stored yet leads to a `nil` interface, the comma-ok form turns it into a `nil` token
+	token, _ := s.active.Load().(*APITokenInfo)
+	return token, nil
 }
 
 func (s *InMemoryAPITokenStore) Set(ctx context.Context, token *APITokenInfo) error {
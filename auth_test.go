@@ -37,6 +37,21 @@ func TestAPITokenInfo_IsAboutToExpire(t *testing.T) {
 	}
 }
 
+func TestInMemoryAPITokenStore(t *testing.T) {
+	store := NewInMemoryAPITokenStore()
+
+	token, err := store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, token, "empty store must return no token")
+
+	expected := &APITokenInfo{Token: "token", ExpiresAt: utcTime(t, "2020-01-01T00:00:00Z")}
+	require.NoError(t, store.Set(context.Background(), expected))
+
+	token, err = store.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, expected, token)
+}
+
 func TestFileAPITokenStore_Get(t *testing.T) {
 	tests := []struct {
 		name        string
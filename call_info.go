@@ -0,0 +1,77 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CallInfo receives the details of a GraphQL call once it completed, see `GraphQLCallInfo`.
+type CallInfo struct {
+	// RequestID is the request ID sent with the call, see `GraphQLRequestID`.
+	RequestID string
+
+	// Header is the response header sent by the server, it usually carries request cost,
+	// rate limiting and tracing information.
+	Header metadata.MD
+
+	// Trailer is the response trailer sent by the server when completing the call.
+	Trailer metadata.MD
+
+	// Status is the final gRPC status of the call, `codes.OK` when it completed successfully.
+	Status *status.Status
+
+	// TimeToFirstByte is the time elapsed between sending the request and receiving the first
+	// response, zero if no response was received.
+	TimeToFirstByte time.Duration
+
+	// Duration is the time elapsed between sending the request and the call's completion.
+	Duration time.Duration
+}
+
+// GraphQLCallInfo option to receive the details of the call (headers, trailers, status and
+// timing) in `info`. For `GraphQLQuery`, it's filled when the method returns. For
+// `GraphQLSubscription`, it's filled once the stream ends, i.e. when `Recv` returns an error
+// (`io.EOF` included).
+//
+// For `GraphQLQuery`, the stream is read until completion to receive the trailer, the
+// document must hence be a single response operation.
+func GraphQLCallInfo(info *CallInfo) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) { o.callInfo = info })
+}
+
+// received records the reception of a response, it must be called on each response received.
+func (c *graphqlCall) received() {
+	if c.info != nil && c.info.TimeToFirstByte == 0 {
+		c.info.TimeToFirstByte = time.Since(c.startedAt)
+	}
+}
+
+// completed records the completion of the call with `err` (`nil` or `io.EOF` meaning a successful
+// completion), capturing the header and trailer sent by the server.
+func (c *graphqlCall) completed(err error) {
+	if c.info == nil {
+		return
+	}
+
+	c.info.Duration = time.Since(c.startedAt)
+	if c.stream != nil {
+		// Header returns an error when no header was received, the returned metadata is nil in this case
+		c.info.Header, _ = c.stream.Header()
+		c.info.Trailer = c.stream.Trailer()
+	}
+
+	switch {
+	case err == nil || err == io.EOF:
+		c.info.Status = status.New(codes.OK, "")
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		c.info.Status = status.FromContextError(err)
+	default:
+		c.info.Status = status.Convert(err)
+	}
+}
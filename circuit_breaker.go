@@ -0,0 +1,302 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrCircuitOpen is returned (wrapped) by GraphQL calls refused because the circuit breaker
+// configured through `WithCircuitBreaker` is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of the client's circuit breaker, see `WithCircuitBreaker`.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all calls through, it's the state of clients without circuit breaker.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen refuses all calls with `ErrCircuitOpen` until `CircuitBreaker.OpenTimeout` elapsed.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited amount of trial calls through, closing the circuit if they
+	// all succeed and opening it back on the first failure.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker defines when the client's circuit breaker opens and how it recovers, zero
+// values are replaced by their documented default.
+type CircuitBreaker struct {
+	// FailureRatio is the ratio of failed calls, over `Window`, at which the circuit opens
+	// (defaults to 0.5).
+	FailureRatio float64
+
+	// MinRequests is the minimum amount of calls over `Window` before the failure ratio is
+	// considered (defaults to 10).
+	MinRequests int
+
+	// Window is the duration over which calls are counted, counters are reset once it
+	// elapsed (defaults to 10s).
+	Window time.Duration
+
+	// OpenTimeout is the time the circuit stays open before letting trial calls through
+	// (defaults to 30s).
+	OpenTimeout time.Duration
+
+	// HalfOpenMaxRequests is the amount of trial calls let through while half-open, they must all
+	// succeed for the circuit to close (defaults to 1).
+	HalfOpenMaxRequests int
+}
+
+// WithCircuitBreaker is an option to stop issuing GraphQL calls to a degraded endpoint. Once the
+// ratio of calls failing with `Unavailable` or `DeadlineExceeded` reaches
+// `CircuitBreaker.FailureRatio`, the circuit opens and calls fail right away with
+// `ErrCircuitOpen`. After `CircuitBreaker.OpenTimeout`, trial calls are let through to decide
+// whether the circuit closes back or opens again. Use `Client.CircuitState` to reflect the state
+// in health endpoints.
+//
+// Queries are accounted on their final outcome, subscriptions on the outcome of their first
+// `Recv` (a message or an error), the server reporting errors only once the stream is read.
+// Calls ended by the cancellation of the caller's context are not accounted, those running out of
+// time (context deadline exceeded) are failures.
+func WithCircuitBreaker(config CircuitBreaker) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.circuitBreaker = &config })
+}
+
+// circuitBreaker implements `WithCircuitBreaker`, all its methods are safe to use on a `nil`
+// receiver in which case every call is allowed.
+type circuitBreaker struct {
+	config CircuitBreaker
+	logger *zap.Logger
+	now    func() time.Time
+
+	lock  sync.Mutex
+	state CircuitState
+	// generation is incremented on each transition, outcomes of calls allowed in a previous
+	// generation are ignored
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+}
+
+func newCircuitBreaker(config *CircuitBreaker, logger *zap.Logger) *circuitBreaker {
+	if config == nil {
+		return nil
+	}
+
+	resolved := *config
+	if resolved.FailureRatio <= 0 {
+		resolved.FailureRatio = 0.5
+	}
+
+	if resolved.MinRequests <= 0 {
+		resolved.MinRequests = 10
+	}
+
+	if resolved.Window <= 0 {
+		resolved.Window = 10 * time.Second
+	}
+
+	if resolved.OpenTimeout <= 0 {
+		resolved.OpenTimeout = 30 * time.Second
+	}
+
+	if resolved.HalfOpenMaxRequests <= 0 {
+		resolved.HalfOpenMaxRequests = 1
+	}
+
+	return &circuitBreaker{config: resolved, logger: logger, now: time.Now, windowStart: time.Now()}
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// An open circuit past its timeout lets the next call through, report it as such
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+
+	return b.state
+}
+
+// allow returns `ErrCircuitOpen` if the call must not be performed, otherwise the returned
+// function must be called with the call's outcome, `ctx` being the caller's context.
+func (b *circuitBreaker) allow(ctx context.Context) (done func(err error), err error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.config.OpenTimeout {
+			return nil, ErrCircuitOpen
+		}
+
+		b.transition(CircuitHalfOpen, now)
+		fallthrough
+
+	case CircuitHalfOpen:
+		if b.trials >= b.config.HalfOpenMaxRequests {
+			return nil, ErrCircuitOpen
+		}
+
+		b.trials++
+	}
+
+	generation := b.generation
+	return func(err error) { b.record(generation, ctx, err) }, nil
+}
+
+func (b *circuitBreaker) record(generation uint64, ctx context.Context, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	// The caller gave up, the call tells nothing about the endpoint, a trial call is released
+	// for another one to decide. A call that ran out of time is a failure of the endpoint though.
+	if errors.Is(ctx.Err(), context.Canceled) {
+		if b.state == CircuitHalfOpen {
+			b.trials--
+		}
+
+		return
+	}
+
+	failed := isCircuitFailure(err)
+	now := b.now()
+
+	switch b.state {
+	case CircuitClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+
+		if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRatio {
+			b.transition(CircuitOpen, now)
+		}
+
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(CircuitOpen, now)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenMaxRequests {
+			b.transition(CircuitClosed, now)
+		}
+	}
+}
+
+// transition moves the circuit to `to`, must be called with the lock held.
+func (b *circuitBreaker) transition(to CircuitState, now time.Time) {
+	b.logger.Info("circuit breaker state changed", zap.Stringer("from", b.state), zap.Stringer("to", to))
+
+	b.state = to
+	b.generation++
+	b.windowStart = now
+	b.requests, b.failures = 0, 0
+	b.trials, b.successes = 0, 0
+	if to == CircuitOpen {
+		b.openedAt = now
+	}
+}
+
+// isCircuitFailure returns whether `err` is a sign of a degraded endpoint that counts toward
+// opening the circuit.
+func isCircuitFailure(err error) bool {
+	switch grpcCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// breakerStream reports the outcome of a stream's first `Recv` to the circuit breaker, or its
+// abandon if the caller's context is done before.
+type breakerStream struct {
+	pbgraphql.GraphQL_ExecuteClient
+
+	done     func(err error)
+	once     sync.Once
+	recorded chan struct{}
+}
+
+func newBreakerStream(ctx context.Context, stream pbgraphql.GraphQL_ExecuteClient, done func(err error)) *breakerStream {
+	s := &breakerStream{GraphQL_ExecuteClient: stream, done: done, recorded: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.record(ctx.Err())
+		case <-s.recorded:
+		}
+	}()
+
+	return s
+}
+
+func (s *breakerStream) Recv() (*pbgraphql.Response, error) {
+	response, err := s.GraphQL_ExecuteClient.Recv()
+	if err == io.EOF {
+		s.record(nil)
+	} else {
+		s.record(err)
+	}
+
+	return response, err
+}
+
+func (s *breakerStream) record(err error) {
+	s.once.Do(func() {
+		s.done(err)
+		close(s.recorded)
+	})
+}
+
+func (c *client) CircuitState() CircuitState {
+	return c.breaker.State()
+}
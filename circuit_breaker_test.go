@@ -0,0 +1,218 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	invalid := status.Error(codes.InvalidArgument, "bad query")
+
+	type step struct {
+		advance       time.Duration
+		outcome       error
+		expectedErr   error
+		expectedState CircuitState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"stays closed under min requests", []step{
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+		}},
+		{"stays closed on non degraded errors", []step{
+			{0, invalid, nil, CircuitClosed},
+			{0, invalid, nil, CircuitClosed},
+			{0, invalid, nil, CircuitClosed},
+			{0, nil, nil, CircuitClosed},
+		}},
+		{"opens on failure ratio", []step{
+			{0, nil, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+			{0, context.DeadlineExceeded, nil, CircuitOpen},
+			{0, nil, ErrCircuitOpen, CircuitOpen},
+		}},
+		{"window resets counters", []step{
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+			{time.Minute, nil, nil, CircuitClosed},
+			{0, nil, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+		}},
+		{"half-open trial closes", []step{
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitOpen},
+			{time.Second, nil, ErrCircuitOpen, CircuitOpen},
+			{5 * time.Second, nil, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+		}},
+		{"half-open trial failure opens back", []step{
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitClosed},
+			{0, unavailable, nil, CircuitOpen},
+			{5 * time.Second, unavailable, nil, CircuitOpen},
+			{0, nil, ErrCircuitOpen, CircuitOpen},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			breaker := newCircuitBreaker(&CircuitBreaker{MinRequests: 3, Window: 10 * time.Second, OpenTimeout: 5 * time.Second}, zap.NewNop())
+			breaker.now = func() time.Time { return now }
+			breaker.windowStart = now
+
+			for i, step := range test.steps {
+				now = now.Add(step.advance)
+
+				done, err := breaker.allow(context.Background())
+				if step.expectedErr != nil {
+					assert.Equal(t, step.expectedErr, err, "step #%d", i)
+				} else {
+					require.NoError(t, err, "step #%d", i)
+					done(step.outcome)
+				}
+
+				assert.Equal(t, step.expectedState, breaker.State(), "step #%d", i)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_HalfOpenLimitsTrials(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := newCircuitBreaker(&CircuitBreaker{MinRequests: 1, OpenTimeout: time.Second}, zap.NewNop())
+	breaker.now = func() time.Time { return now }
+
+	done, err := breaker.allow(context.Background())
+	require.NoError(t, err)
+	done(status.Error(codes.Unavailable, "down"))
+	require.Equal(t, CircuitOpen, breaker.State())
+
+	now = now.Add(time.Second)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+
+	trialDone, err := breaker.allow(context.Background())
+	require.NoError(t, err)
+
+	_, err = breaker.allow(context.Background())
+	assert.Equal(t, ErrCircuitOpen, err, "only one trial call is let through while half-open")
+
+	trialDone(nil)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			return status.Error(codes.Unavailable, "endpoint degraded")
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithCircuitBreaker(CircuitBreaker{MinRequests: 2}))
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	for i := 0; i < 2; i++ {
+		_, err = client.GraphQLQuery(context.Background(), "{ ping }")
+		assert.Equal(t, codes.Unavailable, grpcCode(err))
+	}
+
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	_, err = client.GraphQLQuery(context.Background(), "{ ping }")
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	_, err = client.GraphQLSubscription(context.Background(), "subscription { ping }")
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+}
+
+func TestCircuitBreaker_CallerContextDone(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := newCircuitBreaker(&CircuitBreaker{MinRequests: 1, OpenTimeout: time.Second}, zap.NewNop())
+	breaker.now = func() time.Time { return now }
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done, err := breaker.allow(canceled)
+	require.NoError(t, err)
+	done(status.Error(codes.Unavailable, "canceled while connecting"))
+	assert.Equal(t, CircuitClosed, breaker.State(), "calls abandoned by the caller are not accounted")
+
+	done, err = breaker.allow(context.Background())
+	require.NoError(t, err)
+	done(status.Error(codes.Unavailable, "down"))
+	require.Equal(t, CircuitOpen, breaker.State())
+
+	now = now.Add(time.Second)
+	trialDone, err := breaker.allow(canceled)
+	require.NoError(t, err)
+	trialDone(context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+
+	trialDone, err = breaker.allow(context.Background())
+	require.NoError(t, err, "an abandoned trial call must let another one through")
+	trialDone(nil)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreaker_CallerDeadlineExceeded(t *testing.T) {
+	breaker := newCircuitBreaker(&CircuitBreaker{MinRequests: 1}, zap.NewNop())
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	done, err := breaker.allow(expired)
+	require.NoError(t, err)
+	done(context.DeadlineExceeded)
+	assert.Equal(t, CircuitOpen, breaker.State(), "calls timing out are failures of the endpoint")
+}
+
+func TestClient_CircuitBreaker_UnreachableEndpoint(t *testing.T) {
+	client, err := NewClient("grpc://127.0.0.1:1", "", WithoutAuthentication(), WithCircuitBreaker(CircuitBreaker{MinRequests: 2}))
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err = client.GraphQLQuery(ctx, "{ ping }")
+		cancel()
+		require.Error(t, err)
+	}
+
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+}
+
+func TestClient_CircuitBreaker_StreamFirstRecv(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			return status.Error(codes.Unavailable, "endpoint degraded")
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithCircuitBreaker(CircuitBreaker{MinRequests: 1}))
+	require.NoError(t, err)
+
+	stream, err := client.(ExperimentalClient).RawGraphQL(context.Background(), "subscription { ping }")
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, client.CircuitState(), "stream opening is not its outcome")
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, grpcCode(err))
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+}
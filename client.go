@@ -12,9 +12,13 @@ import (
 	"time"
 
 	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 func WithAPITokenStore(store APITokenStore) ClientOption {
@@ -25,6 +29,19 @@ func WithAuthURL(authURL string) ClientOption {
 	return clientOptionFunc(func(o *clientOptions) { o.authURL = authURL })
 }
 
+// WithNetworkRegistry is an option to replace the registry used to resolve short network
+// names like `eos-mainnet` received by `NewClient`, defaults to `NewDefaultNetworkRegistry()`.
+func WithNetworkRegistry(registry *NetworkRegistry) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.networkRegistry = registry })
+}
+
+// WithNetworkRegistryFile is an option to load the networks defined in the JSON file at
+// `filePath` on top of the network registry, overriding networks with the same name, see
+// `NetworkRegistry.LoadFile` for the file format.
+func WithNetworkRegistryFile(filePath string) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.networkRegistryFile = filePath })
+}
+
 // WithGRPCPort is an option that can be used to overidde all heuristics performed by the client
 // to infer the gRPC port to use based on the network.
 func WithGRPCPort(port int) ClientOption {
@@ -56,6 +73,17 @@ func WithoutAuthentication() ClientOption {
 	return clientOptionFunc(func(o *clientOptions) { o.unauthenticated = true })
 }
 
+// WithGRPCConn is an option to use the received gRPC connection for all gRPC calls instead
+// of dialing the endpoint, enabling sharing a single connection between multiple clients or
+// using an in-process server (like one listening on a `bufconn` listener).
+//
+// The client does not own the connection, it's never closed by `Close`, this is the caller's
+// responsibility. When this option is used, the `network` argument of `NewClient` can be
+// empty, it's then used only to resolve the auth URL of a registered network.
+func WithGRPCConn(conn *grpc.ClientConn) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.grpcConn = conn })
+}
+
 func WithLogger(logger *zap.Logger) ClientOption {
 	return clientOptionFunc(func(o *clientOptions) { o.logger = logger })
 }
@@ -65,8 +93,65 @@ type Client interface {
 
 	GraphQLQuery(ctx context.Context, document string, opts ...GraphQLOption) (*pbgraphql.Response, error)
 	GraphQLSubscription(ctx context.Context, document string, opts ...GraphQLOption) (GraphQLStream, error)
+
+	// GraphQLQueryDocument performs the query defined by `document`, see `GraphQLQuery`. The
+	// document is loaded once and cached for the lifetime of the client.
+	GraphQLQueryDocument(ctx context.Context, document GraphQLDocument, opts ...GraphQLOption) (*pbgraphql.Response, error)
+
+	// GraphQLSubscriptionDocument performs the subscription defined by `document`, see
+	// `GraphQLSubscription`. The document is loaded once and cached for the lifetime of the client.
+	GraphQLSubscriptionDocument(ctx context.Context, document GraphQLDocument, opts ...GraphQLOption) (GraphQLStream, error)
+
+	// GraphQLQueryInto performs the query and decodes the `data` of its response into `out` (a
+	// pointer, like for `json.Unmarshal`). GraphQL errors sent by the server are reported as
+	// `GraphQLErrors` (see `GraphQLErrorPolicy`, `ErrorPolicyPartial` by default), along the
+	// failure to decode `data` if any, `out` receiving whatever could be decoded.
+	GraphQLQueryInto(ctx context.Context, document string, out interface{}, opts ...GraphQLOption) error
+
+	// GraphQLTypedSubscription performs the subscription and returns a stream decoding the
+	// `data` of each message, see `GraphQLTypedStream`.
+	GraphQLTypedSubscription(ctx context.Context, document string, opts ...GraphQLOption) (GraphQLTypedStream, error)
+
+	// GraphQLSchema returns the schema of the endpoint, introspected through the standard
+	// introspection query on first use then cached in memory and on disk, see `WithSchemaCache`.
+	GraphQLSchema(ctx context.Context) (*GraphQLSchema, error)
+
+	// Connect eagerly dials the endpoint and blocks until the gRPC connection is ready, returning
+	// the last connection error (or the context's error) if it's not ready when `ctx` is done.
+	Connect(ctx context.Context) error
+
+	// WaitReady blocks until the gRPC connection is ready, dialing it if needed, returning the
+	// last connection error (or the context's error) if it's not ready when `ctx` is done.
+	//
+	// The connection error is retrieved through a fail-fast `grpc.health.v1.Health/Check` call
+	// each time the connection fails, which does not leave the client while the connection is
+	// down but reaches the server, unauthenticated, if it recovered in the meantime.
+	WaitReady(ctx context.Context) error
+
+	// ConnectivityState returns the current state of the gRPC connection, `connectivity.Idle`
+	// if it has not been dialed yet.
+	ConnectivityState() connectivity.State
+
+	// HealthCheck queries the endpoint's standard `grpc.health.v1.Health` service for the serving
+	// status of `service` (use `GraphQLHealthService` for the GraphQL service, an empty string
+	// for the server as a whole). A non-nil error means the endpoint could not be reached or does
+	// not implement health checking, a service unknown to the server is reported as
+	// `HealthStatusServiceUnknown`.
+	HealthCheck(ctx context.Context, service string) (HealthStatus, error)
+
+	// CircuitState returns the state of the client's circuit breaker, always `CircuitClosed`
+	// when the client has been created without `WithCircuitBreaker`.
+	CircuitState() CircuitState
+
+	// Close releases the gRPC connections dialed by the client, if any. A connection received
+	// through `WithGRPCConn` is left untouched. gRPC calls performed afterwards fail with
+	// `ErrClientClosed` instead of dialing a new connection.
+	Close() error
 }
 
+// ErrClientClosed is returned (wrapped) by gRPC calls performed after `Client.Close`.
+var ErrClientClosed = errors.New("client is closed")
+
 // ExperimentalClient is an interface implemented by the client you received when doing `NewClient` but the
 // method in there are **experimental**, the API could change or removed at any moment.
 //
@@ -75,17 +160,23 @@ type ExperimentalClient interface {
 	RawGraphQL(ctx context.Context, document string, opts ...GraphQLOption) (pbgraphql.GraphQL_ExecuteClient, error)
 }
 
+// NewClient creates a new client connecting to `network`, either a short network name like
+// `eos-mainnet` resolved through the network registry (see `NewDefaultNetworkRegistry`), a bare
+// `host[:port]` value or a URL-style endpoint like `grpcs://mainnet.eos.dfuse.io` that also
+// defines the transport to use, see `Endpoint` for all accepted forms.
 func NewClient(network string, apiKey string, opts ...ClientOption) (Client, error) {
 	zlog.Info("creating new client", zap.String("network", network))
-	if network == "" {
-		return nil, errors.New(`invalid "network" argument, must be set`)
-	}
 
 	options := &clientOptions{}
 	for _, opt := range opts {
 		opt.apply(options)
 	}
 
+	// Without network, all calls must go through a connection or a transport received in options
+	if network == "" && options.grpcConn == nil && options.graphqlTransport == nil && options.webSocketURL == "" {
+		return nil, errors.New(`invalid "network" argument, must be set`)
+	}
+
 	if apiKey == "" && !options.unauthenticated {
 		return nil, errors.New(`invalid "apiKey" argument, must be set (if connecting to an unauthenticated instance, use 'WithoutAuthentication' option to allow and empty "apiKey" argument)`)
 	}
@@ -113,9 +204,46 @@ type client struct {
 	grpcAddr          string
 	grpcDialOptions   []grpc.DialOption
 	grpcConn          *grpc.ClientConn
+	grpcConnOwned     bool
+	grpcCallOptions   []grpc.CallOption
 	grpcGraphqlClient pbgraphql.GraphQLClient
 	grpcLock          sync.Mutex
 
+	// closed is set by `Close`, no gRPC connection is dialed afterwards
+	closed bool
+
+	connectivityObserver  ConnectivityObserver
+	stopConnectivityWatch context.CancelFunc
+
+	metadata map[string]string
+	tracer   trace.Tracer
+	metrics  *clientMetrics
+	limiter  *rateLimiter
+	breaker  *circuitBreaker
+
+	queryRetry *RetryPolicy
+
+	queryTransport  GraphQLTransport
+	streamTransport GraphQLTransport
+	hedgeTransport  GraphQLTransport
+
+	documentCache sync.Map
+	fragments     *FragmentRegistry
+
+	schemaEndpoint string
+	schemaCacheDir string
+	schemaCacheTTL time.Duration
+	schemaLock     sync.Mutex
+	schema         *GraphQLSchema
+
+	validateDocuments bool
+	validationSchema  *GraphQLSchema
+
+	hedgeAddr          string
+	hedgeDialOptions   []grpc.DialOption
+	hedgeConn          *grpc.ClientConn
+	hedgeGraphqlClient pbgraphql.GraphQLClient
+
 	logger *zap.Logger
 }
 
@@ -130,21 +258,69 @@ func (c *client) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 	encoder.AddString("auth_issue_url", c.authIssueURL)
 	encoder.AddBool("authenticated", c.authenticated)
 	encoder.AddString("grpc_addr", c.grpcAddr)
+
+	c.grpcLock.Lock()
 	if c.grpcConn != nil {
 		encoder.AddString("grpc_conn_target", c.grpcConn.Target())
+		encoder.AddBool("grpc_conn_owned", c.grpcConnOwned)
 	}
+	c.grpcLock.Unlock()
 	encoder.AddInt("grpc_dial_option_count", len(c.grpcDialOptions))
 
 	return nil
 }
 
+func (c *client) Close() error {
+	c.grpcLock.Lock()
+	defer c.grpcLock.Unlock()
+
+	c.closed = true
+	if c.stopConnectivityWatch != nil {
+		// The watcher of an owned connection stops by itself once it reported the shutdown below,
+		// a connection received through `WithGRPCConn` stays open and is not observed anymore
+		if !c.grpcConnOwned {
+			c.stopConnectivityWatch()
+		}
+
+		c.stopConnectivityWatch = nil
+	}
+
+	var hedgeErr error
+	if c.hedgeConn != nil {
+		c.logger.Debug("closing hedge grpc connection", zap.String("target", c.hedgeConn.Target()))
+		hedgeErr = c.hedgeConn.Close()
+		c.hedgeConn = nil
+		c.hedgeGraphqlClient = nil
+	}
+
+	if c.grpcConn == nil || !c.grpcConnOwned {
+		return hedgeErr
+	}
+
+	c.logger.Debug("closing owned grpc connection", zap.String("target", c.grpcConn.Target()))
+	err := c.grpcConn.Close()
+	c.grpcConn = nil
+	c.grpcGraphqlClient = nil
+
+	if err == nil {
+		err = hedgeErr
+	}
+
+	return err
+}
+
 type issueTokenResponse struct {
 	Token     string        `json:"token"`
 	ExpiresAt unixTimestamp `json:"expires_at"`
 }
 
-func (c *client) GetAPITokenInfo(ctx context.Context) (*APITokenInfo, error) {
+func (c *client) GetAPITokenInfo(ctx context.Context) (out *APITokenInfo, err error) {
+	ctx, span := c.startSpan(ctx, "dfuse.GetAPITokenInfo")
+	defer func() { endSpan(span, err) }()
+
+	storeGetStartedAt := time.Now()
 	tokenInfo, err := c.apiTokenStore.Get(ctx)
+	c.metrics.tokenStoreOperation("get", storeGetStartedAt)
 	if err != nil {
 		return nil, fmt.Errorf("api token store get: %w", err)
 	}
@@ -154,24 +330,34 @@ func (c *client) GetAPITokenInfo(ctx context.Context) (*APITokenInfo, error) {
 			zlog.Debug("token info retrieved from store is set and not about to expire, returning it", zap.Object("token_info", tokenInfo))
 		}
 
+		span.SetAttributes(attribute.Bool("dfuse.token.cache_hit", true))
 		return tokenInfo, nil
 	}
 
+	span.SetAttributes(attribute.Bool("dfuse.token.cache_hit", false))
+
 	zlog.Debug("token is either not set or about to expire, fetching a new one from auth URL", zap.Object("token_info", tokenInfo), zap.String("auth_issue_url", c.authIssueURL))
 	tokenInfo, err = c.fetchToken(ctx)
+	c.metrics.tokenRefreshed(err)
 	if err != nil {
 		return nil, err
 	}
 
 	zlog.Debug("token retrieved from remote storage, setting it in api token store", zap.Object("token_info", tokenInfo))
-	if err := c.apiTokenStore.Set(ctx, tokenInfo); err != nil {
+	storeSetStartedAt := time.Now()
+	err = c.apiTokenStore.Set(ctx, tokenInfo)
+	c.metrics.tokenStoreOperation("set", storeSetStartedAt)
+	if err != nil {
 		return nil, fmt.Errorf("api token store set: %w", err)
 	}
 
 	return tokenInfo, nil
 }
 
-func (c *client) fetchToken(ctx context.Context) (*APITokenInfo, error) {
+func (c *client) fetchToken(ctx context.Context) (out *APITokenInfo, err error) {
+	ctx, span := c.startSpan(ctx, "dfuse.fetchToken", attribute.String("http.url", c.authIssueURL))
+	defer func() { endSpan(span, err) }()
+
 	entity := map[string]interface{}{"api_key": c.apiKey}
 	body, _ := json.Marshal(entity)
 
@@ -180,11 +366,15 @@ func (c *client) fetchToken(ctx context.Context) (*APITokenInfo, error) {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
 
+	traceContextPropagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
 	response, err := c.authClient.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("http request: %w", err)
 	}
 
+	span.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+
 	if response.StatusCode >= 400 {
 		// FIXME: Deal with response body and return it somehow to consumer, for now, generic error
 		answer, err := consumeBodyToString(response)
@@ -2,86 +2,221 @@ package dfuse
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/proto"
 )
 
 type GraphQLStream interface {
 	pbgraphql.GraphQL_ExecuteClient
 }
 
-func (c *client) GraphQLQuery(ctx context.Context, document string, opts ...GraphQLOption) (*pbgraphql.Response, error) {
-	options := graphqlOptions{}
-	for _, opt := range opts {
-		opt.apply(&options)
-	}
+func (c *client) GraphQLQuery(ctx context.Context, document string, opts ...GraphQLOption) (out *pbgraphql.Response, err error) {
+	ctx, span := c.startSpan(ctx, "dfuse.GraphQLQuery")
+	defer func(startedAt time.Time) {
+		endSpan(span, err)
+		c.metrics.queryCompleted(err, startedAt)
+	}(time.Now())
 
-	graphql, err := c.getGraphqlClient()
+	options := newGraphQLOptions(opts)
+	response, err := c.queryWithRetry(ctx, span, document, opts, options)
 	if err != nil {
-		return nil, fmt.Errorf("get graphql client: %w", err)
+		return nil, err
 	}
 
-	var callOptions []grpc.CallOption
-	if c.authenticated {
-		tokenInfo, err := c.GetAPITokenInfo(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("get api token: %w", err)
-		}
+	return options.errorPolicy.apply(response)
+}
 
-		callOptions = append(callOptions, grpc.PerRPCCredentials(
-			oauth.NewOauthAccess(&oauth2.Token{AccessToken: tokenInfo.Token, TokenType: "Bearer"})),
-		)
+// queryWithRetry performs the query, retrying it according to the client's retry policy if any.
+func (c *client) queryWithRetry(ctx context.Context, span trace.Span, document string, opts []GraphQLOption, options *graphqlOptions) (out *pbgraphql.Response, err error) {
+	if c.queryRetry == nil {
+		return c.queryAttempt(ctx, span, document, opts, options)
 	}
 
-	request := &pbgraphql.Request{Query: document}
-	if len(options.variables) > 0 {
-		request.Variables, err = structpb.NewStruct(options.variables)
-		if err != nil {
-			return nil, fmt.Errorf("invalid variables: %w", err)
+	policy := c.queryRetry
+	backoff := policy.InitialBackoff
+	attempt := 1
+	for ; ; attempt++ {
+		attemptCtx, cancelAttempt := ctx, context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			attemptCtx, cancelAttempt = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+
+		out, err = c.queryAttempt(attemptCtx, span, document, opts, options)
+		attemptTimedOut := ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded
+		cancelAttempt()
+
+		if err == nil || attempt >= policy.MaxAttempts {
+			break
 		}
+
+		if !attemptTimedOut && !c.isRetryableQueryError(ctx, err) {
+			break
+		}
+
+		c.metrics.transientError(err)
+		c.logger.Debug("graphql query transient error occurs, retrying", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("waiting before retrying: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		backoff = policy.nextBackoff(backoff)
+	}
+
+	span.SetAttributes(attribute.Int("dfuse.attempts", attempt))
+	if err != nil {
+		return nil, &RetryError{Attempts: attempt, Err: err}
 	}
 
+	return out, nil
+}
+
+// queryAttempt performs a single query attempt, hedged if requested through `GraphQLHedge`.
+func (c *client) queryAttempt(ctx context.Context, span trace.Span, document string, opts []GraphQLOption, options *graphqlOptions) (*pbgraphql.Response, error) {
+	if options.hedgeDelay > 0 {
+		return c.hedgedQueryAttempt(ctx, span, document, opts, options)
+	}
+
+	return c.graphqlQueryAttempt(ctx, span, document, opts)
+}
+
+// graphqlQueryAttempt performs a single query attempt, it goes through the rate limiter and the
+// circuit breaker like any other call.
+func (c *client) graphqlQueryAttempt(ctx context.Context, span trace.Span, document string, opts []GraphQLOption) (out *pbgraphql.Response, err error) {
+	if err := c.limiter.acquireQuery(ctx); err != nil {
+		return nil, err
+	}
+
+	breakerDone, err := c.breaker.allow(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer func() { breakerDone(err) }()
+
 	subCtx, cancelRequest := context.WithCancel(ctx)
 	defer cancelRequest()
 
-	stream, err := graphql.Execute(subCtx, request, callOptions...)
+	call, err := c.prepareCall(subCtx, "query", document, opts)
 	if err != nil {
-		return nil, fmt.Errorf("graphql execute: %w", err)
+		return nil, err
 	}
 
-	response, err := stream.Recv()
+	span.SetAttributes(attribute.String("dfuse.request_id", call.requestID))
+
+	response, err := call.stream.Recv()
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		call.completed(err)
+		return nil, fmt.Errorf("query failed (request id %s): %w", call.requestID, err)
+	}
+
+	call.received()
+	if call.info != nil {
+		// Trailer is only available once the stream completed, drain it
+		_, err := call.stream.Recv()
+		call.completed(err)
 	}
 
 	return response, nil
 }
 
 func (c *client) GraphQLSubscription(ctx context.Context, document string, opts ...GraphQLOption) (GraphQLStream, error) {
-	stream, err := c.prepareGRPCCall(ctx, "subscription", document, opts)
+	if err := c.limiter.acquireStream(ctx); err != nil {
+		return nil, err
+	}
+
+	breakerDone, err := c.breaker.allow(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("subscription: %w", err)
+	}
+
+	// The stream runs on its own context, canceled when it's replaced on reconnection or ends
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	connectCtx, span := c.startSpan(streamCtx, "dfuse.GraphQLSubscription.connect")
+	call, err := c.prepareCall(connectCtx, "subscription", document, opts)
 	if err != nil {
+		cancelStream()
+		breakerDone(err)
+		endSpan(span, err)
 		return nil, err
 	}
 
-	return &graphqlStream{stream, c.logger, nil}, nil
+	call.stream = newBreakerStream(ctx, call.stream, breakerDone)
+
+	span.SetAttributes(attribute.String("dfuse.request_id", call.requestID))
+	endSpan(span, nil)
+
+	stream := &graphqlStream{
+		GraphQL_ExecuteClient: call.stream,
+		ctx:                   ctx,
+		cancelStream:          cancelStream,
+		call:                  call,
+		logger:                call.logger,
+		tracer:                c.tracer,
+		metrics:               c.metrics,
+		done:                  make(chan struct{}),
+	}
+	if c.metrics != nil {
+		c.metrics.subscriptionStarted(call.operation)
+		go stream.endOnCancel()
+	}
+
+	return stream, nil
 }
 
 type graphqlStream struct {
 	pbgraphql.GraphQL_ExecuteClient
+
+	// ctx is the caller's context, the stream's own context is canceled as soon as the
+	// stream completes and cannot be used to tell apart a caller's cancellation
+	ctx     context.Context
+	call    *graphqlCall
 	logger  *zap.Logger
+	tracer  trace.Tracer
+	metrics *clientMetrics
+	ended   bool
 	lastErr error
+
+	// cancelStream cancels the context of the current stream, see `reconnect`
+	cancelStream context.CancelFunc
+
+	// done is closed once the stream ended, `endOnce` ensures the subscription is accounted as
+	// ended once whether it's through `Recv` or the cancellation of `ctx`
+	done    chan struct{}
+	endOnce sync.Once
 }
 
+// subscriptionReconnectInitialBackoff is the wait time before the first attempt to reconnect a
+// subscription, doubled on each subsequent attempt up to subscriptionReconnectMaxBackoff.
+var subscriptionReconnectInitialBackoff = 100 * time.Millisecond
+var subscriptionReconnectMaxBackoff = 5 * time.Second
+
+// maxReconnectSpanEvents caps the failed attempts recorded as events of a reconnection span, the
+// `dfuse.reconnect.attempts` attribute still counting all of them.
+const maxReconnectSpanEvents = 10
+
 // LastErr returns that last error we seen in this stream. This special stream traps transient
 // errors and automatically reconnects ensure a never ending flow of data so the consumer of
 // client-go does not need to deal with this.
@@ -90,14 +225,49 @@ func (s *graphqlStream) LastErr() error {
 }
 
 func (s *graphqlStream) Recv() (*pbgraphql.Response, error) {
+	response, err := s.recv()
+	if err != nil {
+		if !s.ended {
+			s.ended = true
+			s.call.completed(err)
+			s.cancelStream()
+			s.end()
+		}
+
+		return nil, err
+	}
+
+	s.call.received()
+	s.metrics.subscriptionMessageReceived(s.call.operation, proto.Size(response))
+	return s.call.errorPolicy.apply(response)
+}
+
+func (s *graphqlStream) end() {
+	s.endOnce.Do(func() {
+		close(s.done)
+		s.metrics.subscriptionEnded(s.call.operation)
+	})
+}
+
+// endOnCancel accounts the subscription as ended when the caller cancels `ctx`, it might never
+// call `Recv` again.
+func (s *graphqlStream) endOnCancel() {
+	select {
+	case <-s.ctx.Done():
+		s.end()
+	case <-s.done:
+	}
+}
+
+func (s *graphqlStream) recv() (*pbgraphql.Response, error) {
 	if tracer.Enabled() {
-		zlog.Debug("about to request to receive a graphql response from gRPC stream")
+		s.logger.Debug("about to request to receive a graphql response from gRPC stream")
 	}
 
 	response, err := s.GraphQL_ExecuteClient.Recv()
 	if err == nil {
 		if tracer.Enabled() {
-			zlog.Debug("forwarding graphql received response from gRPC stream to consumer")
+			s.logger.Debug("forwarding graphql received response from gRPC stream to consumer")
 		}
 
 		return response, nil
@@ -105,33 +275,63 @@ func (s *graphqlStream) Recv() (*pbgraphql.Response, error) {
 
 	// It's unclear, but when the context of the stream is canceled, the `Recv` on the stream client
 	// returns io.EOF, if there is a context error, we must forward it here right away
-	ctxErr := s.Context().Err()
+	ctxErr := s.ctx.Err()
 	if ctxErr != nil {
-		zlog.Debug("graphql gRPC initial stream context has been canceled or timed out, returning its error right away", zap.Error(ctxErr))
+		s.logger.Debug("graphql gRPC initial stream context has been canceled or timed out, returning its error right away", zap.Error(ctxErr))
 		return nil, ctxErr
 	}
 
 	if err == io.EOF {
-		zlog.Debug("graphql gRPC stream completed")
+		s.logger.Debug("graphql gRPC stream completed")
 		return nil, io.EOF
 	}
 
 	s.lastErr = err
-	isTransient := s.isTransientError(err)
+	isTransient := isTransientError(err, s.logger)
 	if !isTransient {
-		zlog.Debug("graphql stream permanent error occurs, giving up", zap.Error(err))
+		s.logger.Debug("graphql stream permanent error occurs, giving up", zap.Error(err))
 		return nil, err
 	}
 
+	s.metrics.transientError(err)
+
 	// FIXME: Once we have a correct enough group of unit tests, refactor this code as it's mostly
 	//        the same as the part above this comment expect for a few differences that arise when
 	//        running for the first time vs running as a "retry".
-	zlog.Debug("a graphql stream transient error occurs, re-trying until we succeed", zap.Error(err))
+	s.logger.Debug("a graphql stream transient error occurs, re-trying until we succeed", zap.Error(err))
+
+	// A single span covers the whole reconnection episode, each failed attempt being an event of it
+	_, span := s.tracer.Start(s.ctx, "dfuse.GraphQLSubscription.reconnect", trace.WithAttributes(
+		attribute.String("dfuse.request_id", s.call.requestID),
+		attribute.String("dfuse.last_error", s.lastErr.Error()),
+	))
+
+	attempts := 0
+	reconnected := func(err error) {
+		span.SetAttributes(attribute.Int("dfuse.reconnect.attempts", attempts))
+		endSpan(span, err)
+	}
+
+	backoff := subscriptionReconnectInitialBackoff
 	for {
-		response, err := s.GraphQL_ExecuteClient.Recv()
+		attempts++
+
+		select {
+		case <-s.ctx.Done():
+			reconnected(s.ctx.Err())
+			return nil, s.ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > subscriptionReconnectMaxBackoff {
+			backoff = subscriptionReconnectMaxBackoff
+		}
+
+		response, err := s.reconnect()
 		if err == nil {
+			reconnected(nil)
 			if tracer.Enabled() {
-				zlog.Debug("retry succeeded, forwarding graphql received message from gRPC stream to consumer")
+				s.logger.Debug("retry succeeded, forwarding graphql received message from gRPC stream to consumer")
 			}
 
 			return response, nil
@@ -139,34 +339,64 @@ func (s *graphqlStream) Recv() (*pbgraphql.Response, error) {
 
 		// It's unclear, but when the context of the stream is canceled, the `Recv` on the stream client
 		// returns io.EOF, if there is a context error, we must forward it here right away
-		ctxErr := s.Context().Err()
+		ctxErr := s.ctx.Err()
 		if ctxErr != nil {
-			zlog.Debug("graphql gRPC retried stream context has been canceled or timed out, returning its error right away", zap.Error(ctxErr))
+			reconnected(ctxErr)
+			s.logger.Debug("graphql gRPC retried stream context has been canceled or timed out, returning its error right away", zap.Error(ctxErr))
 			return nil, ctxErr
 		}
 
 		if err == io.EOF {
-			zlog.Debug("graphql gRPC stream completed while retrying")
+			reconnected(nil)
+			s.logger.Debug("graphql gRPC stream completed while retrying")
 			return nil, io.EOF
 		}
 
 		// FIXME: This doesn't work because the receiver of the call is non-pointer ... hmmm
 		s.lastErr = err
-		isTransient := s.isTransientError(err)
+		isTransient := isTransientError(err, s.logger)
 		if !isTransient {
-			zlog.Debug("a graphql stream permanent error occurs while retrying, giving up", zap.Error(err))
+			reconnected(err)
+			s.logger.Debug("a graphql stream permanent error occurs while retrying, giving up", zap.Error(err))
 			return nil, err
 		}
 
-		zlog.Debug("a graphql stream transient error occurs while retrying, let's continue", zap.Error(err))
+		s.metrics.transientError(err)
+		if attempts <= maxReconnectSpanEvents {
+			span.AddEvent("dfuse.reconnect.attempt_failed", trace.WithAttributes(attribute.String("dfuse.error", err.Error())))
+		}
+
+		s.logger.Debug("a graphql stream transient error occurs while retrying, let's continue", zap.Int("attempt", attempts), zap.Duration("backoff", backoff), zap.Error(err))
 	}
 }
 
-func (s *graphqlStream) isTransientError(err error) bool {
+// reconnect replaces the broken stream by a new one performing the same request, the broken one
+// being released by canceling its context, and receives its first response.
+func (s *graphqlStream) reconnect() (*pbgraphql.Response, error) {
+	s.cancelStream()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancelStream = cancel
+
+	stream, err := s.call.reopen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.GraphQL_ExecuteClient = stream
+	s.call.stream = stream
+	s.metrics.subscriptionReconnecting(s.call.operation)
+
+	return stream.Recv()
+}
+
+// isTransientError returns whether `err` is expected to go away by itself, in which case
+// subscriptions reconnect and queries are retried (see `WithQueryRetry`).
+func isTransientError(err error, logger *zap.Logger) bool {
 	switch status.Code(err) {
 	// Weird case where an error would have the OK code, warn & reconnect since we assume it's something wrong
 	case codes.OK:
-		s.logger.Warn("the error has code OK, this is really unexpected in an error case, assuming we need to re-connect", zap.Error(err))
+		logger.Warn("the error has code OK, this is really unexpected in an error case, assuming we need to re-connect", zap.Error(err))
 		return true
 
 	// Clear cases of permanent error that requires user intervention and for which we will NOT reconnect
@@ -202,57 +432,237 @@ func (s *graphqlStream) isTransientError(err error) bool {
 }
 
 func (c *client) RawGraphQL(ctx context.Context, document string, opts ...GraphQLOption) (pbgraphql.GraphQL_ExecuteClient, error) {
-	return c.prepareGRPCCall(ctx, "raw", document, opts)
+	if err := c.limiter.acquireStream(ctx); err != nil {
+		return nil, err
+	}
+
+	breakerDone, err := c.breaker.allow(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("raw: %w", err)
+	}
+
+	call, err := c.prepareCall(ctx, "raw", document, opts)
+	if err != nil {
+		breakerDone(err)
+		return nil, err
+	}
+
+	return newBreakerStream(ctx, call.stream, breakerDone), nil
 }
 
-func (c *client) prepareGRPCCall(
+// graphqlCall is a GraphQL over gRPC call that has been sent to the server.
+type graphqlCall struct {
+	stream    pbgraphql.GraphQL_ExecuteClient
+	requestID string
+	startedAt time.Time
+
+	// info receives the call's details when the caller asked for them, nil otherwise
+	info *CallInfo
+
+	// reopen performs the call's request again on `ctx`, used to reconnect subscriptions
+	reopen func(ctx context.Context) (pbgraphql.GraphQL_ExecuteClient, error)
+
+	// logger is the client's logger annotated with the call's request ID
+	logger *zap.Logger
+
+	// errorPolicy surfaces the GraphQL errors of the responses, see `GraphQLErrorPolicy`
+	errorPolicy ErrorPolicy
+
+	// operation is the name of the subscription's operation labelling its metrics
+	operation string
+}
+
+func (c *client) prepareCall(
 	ctx context.Context,
 	tag string,
 	document string,
 	opts []GraphQLOption,
-) (stream pbgraphql.GraphQL_ExecuteClient, err error) {
-	options := graphqlOptions{}
-	for _, opt := range opts {
-		opt.apply(&options)
+) (call *graphqlCall, err error) {
+	options := newGraphQLOptions(opts)
+	requestID := options.requestID
+	if requestID == "" {
+		requestID = options.metadata[RequestIDMetadataKey]
 	}
 
-	graphql, err := c.getGraphqlClient()
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	logger := c.logger.With(zap.String("request_id", requestID))
+	ctx = c.outgoingContext(ctx, requestID, options.metadata)
+
+	call = &graphqlCall{requestID: requestID, info: options.callInfo, logger: logger, errorPolicy: options.errorPolicy}
+	if call.info != nil {
+		*call.info = CallInfo{RequestID: requestID}
+	}
+
+	transport := c.streamTransport
+	if tag == "query" {
+		transport = c.queryTransport
+	}
+
+	if options.hedgeEndpoint {
+		transport = c.hedgeTransport
+	}
+
+	// The document is parsed once for all the steps below, one which doesn't parse is left to the
+	// server to report unless a step requires it
+	parsed, parseErr := parseDocument(document)
+
+	// Registered fragments appended to the document are shared with other calls
+	sharesFragments := false
+	if c.fragments != nil {
+		if parseErr != nil {
+			return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, parseErr)
+		}
+
+		var resolved *ast.QueryDocument
+		document, resolved, err = c.fragments.resolve(document, parsed)
+		sharesFragments = resolved != parsed
+		parsed = resolved
+	} else if parseErr == nil {
+		_, _, err = resolveFragments(document, parsed, nil, false)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("get graphql client: %w", err)
+		return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, err)
 	}
 
-	var callOptions []grpc.CallOption
-	if c.authenticated {
-		tokenInfo, err := c.GetAPITokenInfo(ctx)
+	if options.operationName != "" {
+		if parseErr != nil {
+			return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, parseErr)
+		}
+
+		document, parsed, err = selectOperation(document, parsed, options.operationName)
 		if err != nil {
-			return nil, fmt.Errorf("get api token: %w", err)
+			return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, err)
 		}
+	}
 
-		callOptions = append(callOptions, grpc.PerRPCCredentials(
-			oauth.NewOauthAccess(&oauth2.Token{AccessToken: tokenInfo.Token, TokenType: "Bearer"})),
-		)
+	token, err := c.apiToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.variablesErr != nil {
+		return nil, fmt.Errorf("invalid variables: %w", options.variablesErr)
+	}
+
+	if tag == "subscription" && c.metrics != nil {
+		call.operation = options.operationName
+		if call.operation == "" {
+			call.operation = operationNameOf(parsed)
+		}
 	}
 
-	request := &pbgraphql.Request{Query: document}
+	validate := c.validateDocuments && !options.skipValidation
+
+	var schema *GraphQLSchema
+	if validate {
+		if schema, err = c.documentValidationSchema(ctx); err != nil {
+			return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, err)
+		}
+	}
+
+	request := &pbgraphql.Request{Query: document, OperationName: options.operationName}
 	if len(options.variables) > 0 {
-		request.Variables, err = structpb.NewStruct(options.variables)
+		types := &variableTypes{definitions: variableDefinitionsOf(parsed, options.operationName)}
+		if schema != nil {
+			types.schema = schema.Schema
+		}
+
+		request.Variables, err = newVariablesStruct(options.variables, types)
 		if err != nil {
 			return nil, fmt.Errorf("invalid variables: %w", err)
 		}
 	}
 
-	zlog.Debug("executing graphql request over gRPC", zap.Reflect("request", request))
-	stream, err = graphql.Execute(ctx, request, callOptions...)
+	if validate {
+		// Variables are validated as sent, a copy the validator is free to alter
+		variables := map[string]interface{}{}
+		if request.Variables != nil {
+			variables = request.Variables.AsMap()
+		}
+
+		switch {
+		case parseErr != nil:
+			err = newValidationError(gqlerror.List{toGQLError(parseErr)})
+		case sharesFragments:
+			// The validator annotates the document it checks, the registered fragments can't be
+			// part of it
+			err = schema.Validate(document, variables, options.operationName)
+		default:
+			err = schema.validate(parsed, variables, options.operationName)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("graphql %s (request id %s): %w", tag, requestID, err)
+		}
+	}
+
+	call.reopen = func(ctx context.Context) (pbgraphql.GraphQL_ExecuteClient, error) {
+		token, err := c.apiToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return transport.Execute(c.outgoingContext(ctx, requestID, options.metadata), request, token)
+	}
+
+	logger.Debug("executing graphql request", zap.String("tag", tag), zap.Reflect("request", request))
+	call.startedAt = time.Now()
+	call.stream, err = transport.Execute(ctx, request, token)
 	if err != nil {
-		return nil, fmt.Errorf("graphql execute %s: %w", tag, err)
+		call.completed(err)
+		return nil, fmt.Errorf("graphql execute %s (request id %s): %w", tag, requestID, err)
 	}
 
-	return stream, nil
+	return call, nil
 }
 
-func (c *client) getGraphqlClient() (pbgraphql.GraphQLClient, error) {
-	_, err := c.getGRPCConn()
+// grpcCallOptionsFor returns the call options to use for a gRPC call made with `ctx`, this
+// includes the API token credentials when the client is authenticated.
+func (c *client) grpcCallOptionsFor(ctx context.Context) ([]grpc.CallOption, error) {
+	token, err := c.apiToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.grpcCallOptionsWithToken(token), nil
+}
+
+// grpcCallOptionsWithToken returns the call options to use for a gRPC call authenticated with
+// `token`, an empty token meaning an unauthenticated call.
+func (c *client) grpcCallOptionsWithToken(token string) []grpc.CallOption {
+	callOptions := append([]grpc.CallOption(nil), c.grpcCallOptions...)
+	if token != "" {
+		callOptions = append(callOptions, grpc.PerRPCCredentials(
+			oauth.NewOauthAccess(&oauth2.Token{AccessToken: token, TokenType: "Bearer"})),
+		)
+	}
+
+	return callOptions
+}
+
+// apiToken returns the API token to authenticate calls with, empty when the client is
+// unauthenticated.
+func (c *client) apiToken(ctx context.Context) (string, error) {
+	if !c.authenticated {
+		return "", nil
+	}
+
+	tokenInfo, err := c.GetAPITokenInfo(ctx)
 	if err != nil {
+		return "", fmt.Errorf("get api token: %w", err)
+	}
+
+	return tokenInfo.Token, nil
+}
+
+func (c *client) getGraphqlClient() (pbgraphql.GraphQLClient, error) {
+	c.grpcLock.Lock()
+	defer c.grpcLock.Unlock()
+
+	if _, err := c.dialLocked(); err != nil {
 		return nil, fmt.Errorf("get grpc connection: %w", err)
 	}
 
@@ -260,49 +670,49 @@ func (c *client) getGraphqlClient() (pbgraphql.GraphQLClient, error) {
 }
 
 func (c *client) getGRPCConn() (*grpc.ClientConn, error) {
-	if c.grpcConn != nil {
-		return c.grpcConn, nil
-	}
-
 	c.grpcLock.Lock()
 	defer c.grpcLock.Unlock()
 
-	// It might have been set after we obtain lock, return right away if it's the case
+	return c.dialLocked()
+}
+
+// dialLocked returns the gRPC connection, dialing it on first use, `grpcLock` must be held as
+// the connection is released concurrently by `Close`.
+func (c *client) dialLocked() (*grpc.ClientConn, error) {
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
 	if c.grpcConn != nil {
 		return c.grpcConn, nil
 	}
 
+	if c.grpcAddr == "" {
+		return nil, errors.New("no gRPC endpoint configured, the client uses another transport")
+	}
+
 	var err error
 	c.grpcConn, err = newGRPCClient(c.grpcAddr, c.grpcDialOptions...)
 	if err == nil {
+		c.grpcConnOwned = true
 		c.grpcGraphqlClient = pbgraphql.NewGraphQLClient(c.grpcConn)
+		c.watchConnectivity(c.grpcConn)
 	}
 
 	return c.grpcConn, err
 }
 
-type GraphQLDocument interface {
-	Load(ctx context.Context) (string, error)
-}
-
-type GraphQLStringDocument string
-
-func (d GraphQLStringDocument) Load(ctx context.Context) (string, error) {
-	return string(d), nil
-}
-
-type GraphQLFileDocument string
-
-func (d GraphQLFileDocument) Load(ctx context.Context) (string, error) {
-	content, err := ioutil.ReadFile(string(d))
-	return string(content), err
-}
-
 type GraphQLOption interface {
 	apply(o *graphqlOptions)
 }
 
-// GraphQLVariables option to pass
+// GraphQLVariables option to pass the variables of the call. Values of any type marshalling to
+// JSON are accepted (structs, `time.Time`, typed slices, ...). Integers a float64 cannot represent
+// exactly, like `Int64`/`Uint64` block numbers or amounts above 2^53, are sent as strings instead
+// of losing precision, the form custom scalars accept. Values of variables the operation declares
+// of a builtin scalar (like `Float` or `[Int!]`) are sent as numbers, as well as the ones of input
+// object fields of such scalars when the schema is known (see `WithDocumentValidation`). See
+// `GraphQLVariablesOf` to pass the variables as a struct.
 type GraphQLVariables map[string]interface{}
 
 func (f GraphQLVariables) apply(o *graphqlOptions) {
@@ -315,8 +725,47 @@ func (f GraphQLVariables) apply(o *graphqlOptions) {
 	}
 }
 
+// GraphQLMetadata option to attach gRPC metadata (i.e. headers like `x-trace-id`) to the
+// outgoing call, merged with the client-wide metadata defined through `WithMetadata`, keys
+// defined here win. Keys are lower-cased as mandated by gRPC.
+type GraphQLMetadata map[string]string
+
+func (f GraphQLMetadata) apply(o *graphqlOptions) {
+	if o.metadata == nil {
+		o.metadata = map[string]string{}
+	}
+
+	for key, value := range f {
+		o.metadata[strings.ToLower(key)] = value
+	}
+}
+
+// GraphQLRequestID option to use `id` as the call's request ID instead of a generated one, the
+// request ID is sent in the `x-request-id` metadata and attached to logs and errors of the call.
+func GraphQLRequestID(id string) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) { o.requestID = id })
+}
+
 type graphqlOptions struct {
-	variables map[string]interface{}
+	variables      map[string]interface{}
+	metadata       map[string]string
+	requestID      string
+	callInfo       *CallInfo
+	errorPolicy    ErrorPolicy
+	hedgeDelay     time.Duration
+	hedgeEndpoint  bool
+	operationName  string
+	skipValidation bool
+	variablesErr   error
+}
+
+func newGraphQLOptions(opts []GraphQLOption) *graphqlOptions {
+	options := &graphqlOptions{}
+	for _, opt := range opts {
+		opt.apply(options)
+	}
+
+	return options
 }
 
 type graphqlOptionFunc func(o *graphqlOptions)
@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"regexp"
 	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 )
 
 type ClientOption interface {
@@ -25,6 +28,30 @@ type clientOptions struct {
 	plainText       bool
 	unauthenticated bool
 	logger          *zap.Logger
+
+	networkRegistry     *NetworkRegistry
+	networkRegistryFile string
+
+	grpcConn             *grpc.ClientConn
+	connectivityObserver ConnectivityObserver
+	proxyURL             string
+	metadata             map[string]string
+	tracerProvider       trace.TracerProvider
+	metricsRegisterer    prometheus.Registerer
+	rateLimit            *RateLimit
+	circuitBreaker       *CircuitBreaker
+	queryRetry           *RetryPolicy
+	hedgeEndpoint        string
+	graphqlTransport     GraphQLTransport
+	httpTransportURL     string
+	webSocketURL         string
+	webSocketProtocol    WebSocketProtocol
+	fragmentRegistry     *FragmentRegistry
+	schemaCacheDir       *string
+	schemaCacheTTL       time.Duration
+	documentValidation   bool
+	validationSchema     *GraphQLSchema
+	persistedQueries     bool
 }
 
 func (c *clientOptions) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
@@ -39,20 +66,55 @@ func (c *clientOptions) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 	encoder.AddBool("insecure", c.insecure)
 	encoder.AddBool("plain_text", c.plainText)
 	encoder.AddBool("unauthenticated", c.unauthenticated)
+	encoder.AddString("network_registry_file", c.networkRegistryFile)
+	encoder.AddBool("grpc_conn_injected", c.grpcConn != nil)
+	if c.proxyURL != "" {
+		proxyURL := "<invalid>"
+		if parsed, err := url.Parse(c.proxyURL); err == nil {
+			proxyURL = parsed.Redacted()
+		}
+
+		encoder.AddString("proxy_url", proxyURL)
+	}
 
 	return nil
 }
 
-var portSuffixRegex = regexp.MustCompile(":[0-9]{2,5}$")
-
 func (o *clientOptions) newClient(network string, apiKey string) (*client, error) {
 	logger := o.logger
 	if logger == nil {
 		logger = zlog
 	}
 
+	registry := o.networkRegistry
+	if registry == nil {
+		registry = NewDefaultNetworkRegistry()
+	}
+
+	if o.networkRegistryFile != "" {
+		// Work on a copy, a registry received through options might be shared with other clients
+		registry = registry.clone()
+		if err := registry.LoadFile(o.networkRegistryFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if known, found := registry.Lookup(network); found {
+		logger.Debug("network resolved through registry", zap.String("network", network), zap.String("endpoint", known.Endpoint), zap.String("auth_url", known.AuthURL))
+		network = known.Endpoint
+
+		if o.authURL == "" {
+			o.authURL = known.AuthURL
+		}
+	}
+
+	if known, found := registry.Lookup(o.hedgeEndpoint); found {
+		logger.Debug("hedge endpoint resolved through registry", zap.String("network", o.hedgeEndpoint), zap.String("endpoint", known.Endpoint))
+		o.hedgeEndpoint = known.Endpoint
+	}
+
 	if o.authURL == "" {
-		o.authURL = "https://auth.dfuse.io"
+		o.authURL = DefaultAuthURL
 	}
 
 	logger.Debug("about to create new client with options", zap.Object("options", o))
@@ -64,6 +126,11 @@ func (o *clientOptions) newClient(network string, apiKey string) (*client, error
 
 	authURL.Path = path.Join(authURL.Path, "v1", "auth", "issue")
 
+	metrics, err := newClientMetrics(o.metricsRegisterer)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &client{
 		apiKey:        apiKey,
 		apiTokenStore: o.apiTokenStore,
@@ -71,33 +138,199 @@ func (o *clientOptions) newClient(network string, apiKey string) (*client, error
 		authClient:    &http.Client{Timeout: 10 * time.Second},
 		authIssueURL:  authURL.String(),
 		logger:        logger,
+
+		connectivityObserver: o.connectivityObserver,
+		metadata:             o.metadata,
+		tracer:               newTracer(o.tracerProvider),
+		metrics:              metrics,
+		limiter:              newRateLimiter(o.rateLimit),
+		breaker:              newCircuitBreaker(o.circuitBreaker, logger),
+		queryRetry:           newRetryPolicy(o.queryRetry),
+		fragments:            o.fragmentRegistry,
+		schemaEndpoint:       o.schemaEndpoint(network),
+		schemaCacheDir:       defaultSchemaCacheDir(),
+		schemaCacheTTL:       DefaultSchemaCacheTTL,
+		validateDocuments:    o.documentValidation,
+		validationSchema:     o.validationSchema,
+	}
+
+	if o.schemaCacheDir != nil {
+		c.schemaCacheDir, c.schemaCacheTTL = *o.schemaCacheDir, o.schemaCacheTTL
 	}
 
 	if c.apiTokenStore == nil {
 		c.apiTokenStore = NewOnDiskAPITokenStore(apiKey)
 	}
 
-	c.grpcAddr = network
-	if !portSuffixRegex.MatchString(c.grpcAddr) {
+	var proxy proxyResolver
+	if o.proxyURL != "" {
+		proxy, err = newProxyResolver(o.proxyURL)
+		if err != nil {
+			return nil, err
+		}
+
+		c.authClient.Transport = proxy.httpTransport()
+		c.grpcDialOptions = append(c.grpcDialOptions, grpc.WithContextDialer(proxy.grpcDialer()))
+	}
+
+	if err := o.setTransports(c, proxy); err != nil {
+		return nil, err
+	}
+
+	if o.persistedQueries {
+		if err := c.usePersistedQueries(); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.hedgeEndpoint != "" {
+		addr, transportOptions, err := o.grpcTarget(o.hedgeEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("hedge endpoint: %w", err)
+		}
+
+		c.hedgeAddr = addr
+		c.hedgeDialOptions = append(append([]grpc.DialOption(nil), c.grpcDialOptions...), transportOptions...)
+	}
+
+	if o.grpcConn != nil {
+		// Dial options are not applicable to an injected connection, default call options are
+		// passed on each call instead
+		c.grpcAddr = o.grpcConn.Target()
+		c.grpcConn = o.grpcConn
+		c.grpcCallOptions = defaultCallOptions
+		c.grpcGraphqlClient = pbgraphql.NewGraphQLClient(o.grpcConn)
+		c.watchConnectivity(o.grpcConn)
+
+		return c, nil
+	}
+
+	if network == "" {
+		// Only possible when all calls go through another transport, see `NewClient`
+		return c, nil
+	}
+
+	addr, transportOptions, err := o.grpcTarget(network)
+	if err != nil {
+		return nil, err
+	}
+
+	c.grpcAddr = addr
+	c.grpcDialOptions = append(c.grpcDialOptions, transportOptions...)
+
+	return c, nil
+}
+
+// schemaEndpoint returns the endpoint identifying the schema cached on disk, the endpoint
+// queries are sent to, `network` being used for custom transports (empty if not given).
+func (o *clientOptions) schemaEndpoint(network string) string {
+	switch {
+	case o.graphqlTransport != nil:
+		return network
+	case o.httpTransportURL != "":
+		return o.httpTransportURL
+	case o.webSocketURL != "":
+		return o.webSocketURL
+	case o.grpcConn != nil:
+		return o.grpcConn.Target()
+	default:
+		return network
+	}
+}
+
+// setTransports selects the transports of queries and subscriptions, gRPC unless another
+// transport was requested through options.
+func (o *clientOptions) setTransports(c *client, proxy proxyResolver) error {
+	overGRPC := &grpcTransport{client: c}
+	c.queryTransport, c.streamTransport = overGRPC, overGRPC
+	if o.hedgeEndpoint != "" {
+		c.hedgeTransport = &grpcTransport{client: c, hedge: true}
+	}
+
+	if o.graphqlTransport != nil {
+		c.queryTransport, c.streamTransport = o.graphqlTransport, o.graphqlTransport
+		return nil
+	}
+
+	if o.webSocketURL != "" {
+		if err := validateTransportURL(o.webSocketURL, "ws", "wss"); err != nil {
+			return fmt.Errorf("websocket transport: %w", err)
+		}
+
+		if o.webSocketProtocol != GraphQLTransportWS && o.webSocketProtocol != SubscriptionsTransportWS {
+			return fmt.Errorf("websocket transport: unknown protocol %q", o.webSocketProtocol)
+		}
+
+		webSocket := newWebSocketTransport(o.webSocketURL, o.webSocketProtocol, o.transportHTTPClient(proxy), c.logger)
+		c.queryTransport, c.streamTransport = webSocket, webSocket
+	}
+
+	if o.httpTransportURL != "" {
+		if err := validateTransportURL(o.httpTransportURL, "http", "https"); err != nil {
+			return fmt.Errorf("http transport: %w", err)
+		}
+
+		c.queryTransport = &httpTransport{url: o.httpTransportURL, httpClient: o.transportHTTPClient(proxy)}
+	}
+
+	return nil
+}
+
+// grpcTarget returns the address to dial for `network` (an already resolved endpoint), with
+// the port inferred from options and transport when absent, and the transport's dial options.
+func (o *clientOptions) grpcTarget(network string) (addr string, dialOptions []grpc.DialOption, err error) {
+	endpoint, err := ParseEndpoint(network)
+	if err != nil {
+		return "", nil, err
+	}
+
+	transport, err := o.resolveTransport(endpoint)
+	if err != nil {
+		return "", nil, err
+	}
+
+	addr = endpoint.Target
+	if !endpoint.HasPort() {
 		// Explicitely defined, use it
 		if o.grpcPort != 0 {
-			c.grpcAddr += ":" + strconv.FormatInt(int64(o.grpcPort), 10)
-		} else if o.plainText {
-			c.grpcAddr += ":9000"
+			addr += ":" + strconv.FormatInt(int64(o.grpcPort), 10)
+		} else if transport == TransportPlainText {
+			addr += ":9000"
 		} else {
-			c.grpcAddr += ":443"
+			addr += ":443"
 		}
 	}
 
+	switch transport {
+	case TransportPlainText:
+		return addr, []grpc.DialOption{plainTextDialOption}, nil
+	case TransportInsecureTLS:
+		return addr, []grpc.DialOption{insecureTLSDialOption}, nil
+	default:
+		return addr, []grpc.DialOption{secureTLSDialOption}, nil
+	}
+}
+
+// resolveTransport returns the transport implied by the endpoint's scheme if any, otherwise
+// the one selected through `WithPlainText`/`WithInsecure` options, or the endpoint's default one
+// when none is used. Options contradicting the endpoint's scheme are reported as an error.
+func (o *clientOptions) resolveTransport(endpoint *Endpoint) (Transport, error) {
+	fromOptions := endpoint.DefaultTransport()
 	if o.plainText {
-		c.grpcDialOptions = append(c.grpcDialOptions, plainTextDialOption)
+		fromOptions = TransportPlainText
 	} else if o.insecure {
-		c.grpcDialOptions = append(c.grpcDialOptions, insecureTLSDialOption)
-	} else {
-		c.grpcDialOptions = append(c.grpcDialOptions, secureTLSDialOption)
+		fromOptions = TransportInsecureTLS
 	}
 
-	return c, nil
+	if endpoint.Transport == TransportUnspecified {
+		return fromOptions, nil
+	}
+
+	if (o.plainText || o.insecure) && fromOptions != endpoint.Transport {
+		return TransportUnspecified, fmt.Errorf("endpoint %q implies %s transport which conflicts with %s transport requested through options", endpoint, endpoint.Transport, fromOptions)
+	}
+
+	return endpoint.Transport, nil
 }
 
 type clientOptionFunc func(o *clientOptions)
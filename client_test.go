@@ -0,0 +1,376 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClient_WithGRPCConn(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			return stream.Send(&pbgraphql.Response{Data: `{"query":"` + request.Query + `"}`})
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithAPITokenStore(NewInMemoryAPITokenStore()))
+	require.NoError(t, err)
+
+	response, err := client.GraphQLQuery(context.Background(), "{ ping }")
+	require.NoError(t, err)
+	assert.Equal(t, `{"query":"{ ping }"}`, response.Data)
+
+	require.NoError(t, client.Close())
+	assert.NotEqual(t, connectivity.Shutdown, conn.GetState(), "injected connection must not be closed by client")
+}
+
+func TestClient_Close_Concurrent(t *testing.T) {
+	client, err := NewClient("grpc://127.0.0.1:1", "", WithoutAuthentication())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			client.Connect(ctx)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, client.Close())
+	}
+	<-done
+}
+
+func TestClient_CallAfterClose(t *testing.T) {
+	client, err := NewClient("grpc://127.0.0.1:1", "", WithoutAuthentication(), WithHedgeEndpoint("grpc://127.0.0.1:2"))
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	_, err = client.GraphQLQuery(context.Background(), "{ ping }")
+	assert.True(t, errors.Is(err, ErrClientClosed), "unexpected error %v", err)
+
+	_, err = client.GraphQLQuery(context.Background(), "{ ping }", GraphQLHedge(time.Nanosecond))
+	assert.True(t, errors.Is(err, ErrClientClosed), "unexpected error %v", err)
+
+	assert.True(t, errors.Is(client.Connect(context.Background()), ErrClientClosed))
+}
+
+func TestClient_Connect(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{})
+
+	transitions := make(chan connectivity.State, 10)
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithConnectivityObserver(func(from, to connectivity.State) {
+		transitions <- to
+	}))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, client.Connect(ctx))
+	assert.Equal(t, connectivity.Ready, client.ConnectivityState())
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state := <-transitions:
+			if state == connectivity.Ready {
+				return
+			}
+		case <-timeout:
+			t.Fatal("connectivity observer was not notified of the ready state")
+		}
+	}
+}
+
+func TestClient_Close_ObserverNotifiedOfShutdown(t *testing.T) {
+	transitions := make(chan connectivity.State, 10)
+	client, err := NewClient("grpc://127.0.0.1:1", "", WithoutAuthentication(), WithConnectivityObserver(func(from, to connectivity.State) {
+		transitions <- to
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.Error(t, client.Connect(ctx))
+	require.NoError(t, client.Close())
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state := <-transitions:
+			if state == connectivity.Shutdown {
+				return
+			}
+		case <-timeout:
+			t.Fatal("connectivity observer was not notified of the shutdown state")
+		}
+	}
+}
+
+func TestClient_WaitReady_ConnectionError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client, err := NewClient("grpc://"+addr, "", WithoutAuthentication())
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err = client.WaitReady(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestClient_HealthCheck(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(GraphQLHealthService, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	conn := newTestGRPCConn(t, &testGraphQLServer{}, func(server *grpc.Server) {
+		grpc_health_v1.RegisterHealthServer(server, healthServer)
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication())
+	require.NoError(t, err)
+
+	tests := []struct {
+		service     string
+		expected    HealthStatus
+		expectedErr error
+	}{
+		{"", HealthStatusServing, nil},
+		{GraphQLHealthService, HealthStatusNotServing, nil},
+		{"unknown.Service", HealthStatusServiceUnknown, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.service, func(t *testing.T) {
+			actual, err := client.HealthCheck(context.Background(), test.service)
+			require.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestClient_Metadata(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			data, _ := json.Marshal(map[string][]string{
+				"tenant":       md.Get("tenant"),
+				"x-trace-id":   md.Get("x-trace-id"),
+				"x-request-id": md.Get("x-request-id"),
+			})
+
+			return stream.Send(&pbgraphql.Response{Data: string(data)})
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithMetadata(map[string]string{"Tenant": "acme", "x-trace-id": "client"}))
+	require.NoError(t, err)
+
+	response, err := client.GraphQLQuery(context.Background(), "{ ping }", GraphQLMetadata{"X-Trace-Id": "call"}, GraphQLRequestID("req-1"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tenant":["acme"],"x-trace-id":["call"],"x-request-id":["req-1"]}`, response.Data)
+
+	response, err = client.GraphQLQuery(context.Background(), "{ ping }")
+	require.NoError(t, err)
+
+	var actual map[string][]string
+	require.NoError(t, json.Unmarshal([]byte(response.Data), &actual))
+	assert.Equal(t, []string{"client"}, actual["x-trace-id"])
+	require.Len(t, actual["x-request-id"], 1)
+	assert.Len(t, actual["x-request-id"][0], 16)
+}
+
+func TestClient_SubscriptionLogsRequestID(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{"a":1}`}}}
+
+	client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithLogger(zap.New(core)))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLSubscription(context.Background(), "subscription { a }", GraphQLRequestID("req-1"))
+	require.NoError(t, err)
+	receiveAll(t, stream)
+
+	completed := logs.FilterMessage("graphql gRPC stream completed").All()
+	require.Len(t, completed, 1)
+	assert.Equal(t, "req-1", completed[0].ContextMap()["request_id"])
+}
+
+func TestClient_CallInfo(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			stream.SetHeader(metadata.Pairs("x-cost", "10"))
+			stream.SetTrailer(metadata.Pairs("x-rate-limit-remaining", "90"))
+
+			count := 1
+			if request.Query == "subscription" {
+				count = 2
+			}
+
+			for i := 0; i < count; i++ {
+				if err := stream.Send(&pbgraphql.Response{Data: `{}`}); err != nil {
+					return err
+				}
+			}
+
+			if request.Query == "failing" {
+				return status.Error(codes.ResourceExhausted, "rate limited")
+			}
+
+			return nil
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication())
+	require.NoError(t, err)
+
+	t.Run("query", func(t *testing.T) {
+		info := &CallInfo{}
+		_, err := client.GraphQLQuery(context.Background(), "query", GraphQLCallInfo(info), GraphQLRequestID("req-1"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "req-1", info.RequestID)
+		assert.Equal(t, []string{"10"}, info.Header.Get("x-cost"))
+		assert.Equal(t, []string{"90"}, info.Trailer.Get("x-rate-limit-remaining"))
+		assert.Equal(t, codes.OK, info.Status.Code())
+		assert.NotZero(t, info.TimeToFirstByte)
+		assert.GreaterOrEqual(t, int64(info.Duration), int64(info.TimeToFirstByte))
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		info := &CallInfo{}
+		stream, err := client.GraphQLSubscription(context.Background(), "subscription", GraphQLCallInfo(info))
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			_, err := stream.Recv()
+			require.NoError(t, err)
+		}
+
+		assert.Nil(t, info.Status, "info must be filled only once the stream ends")
+
+		_, err = stream.Recv()
+		require.Equal(t, io.EOF, err)
+		assert.Equal(t, codes.OK, info.Status.Code())
+		assert.Equal(t, []string{"90"}, info.Trailer.Get("x-rate-limit-remaining"))
+	})
+
+	t.Run("query failing after response", func(t *testing.T) {
+		info := &CallInfo{}
+		_, err := client.GraphQLQuery(context.Background(), "failing", GraphQLCallInfo(info))
+		require.NoError(t, err)
+
+		assert.Equal(t, codes.ResourceExhausted, info.Status.Code())
+		assert.Equal(t, []string{"90"}, info.Trailer.Get("x-rate-limit-remaining"))
+	})
+}
+
+func TestClient_SubscriptionEnd(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			if err := stream.Send(&pbgraphql.Response{Data: `{}`}); err != nil {
+				return err
+			}
+
+			if request.Query == "endless" {
+				<-stream.Context().Done()
+			}
+
+			return nil
+		},
+	})
+
+	client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication())
+	require.NoError(t, err)
+
+	t.Run("completed by server", func(t *testing.T) {
+		stream, err := client.GraphQLSubscription(context.Background(), "completed")
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("canceled by caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.GraphQLSubscription(ctx, "endless")
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		require.NoError(t, err)
+
+		cancel()
+		_, err = stream.Recv()
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+type testGraphQLServer struct {
+	pbgraphql.UnimplementedGraphQLServer
+
+	execute func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error
+}
+
+func (s *testGraphQLServer) Execute(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+	return s.execute(request, stream)
+}
+
+// newTestGRPCConn starts an in-process gRPC server serving `graphql` (and any extra service
+// registered by `registers`) and returns a plain-text connection to it, both are torn down
+// when the test completes.
+func newTestGRPCConn(t *testing.T, graphql pbgraphql.GraphQLServer, registers ...func(server *grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pbgraphql.RegisterGraphQLServer(server, graphql)
+	for _, register := range registers {
+		register(server)
+	}
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		plainTextDialOption,
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	dfuse "github.com/streamingfast/client-go"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// builtinScalars are the Go types of the scalars known to the generator, the integer custom
+// scalars of dfuse schemas are carried as JSON numbers.
+var builtinScalars = map[string]string{
+	"Int":     "int",
+	"Float":   "float64",
+	"String":  "string",
+	"Boolean": "bool",
+	"ID":      "string",
+	"Int8":    "int8",
+	"Int16":   "int16",
+	"Int32":   "int32",
+	"Uint8":   "uint8",
+	"Uint16":  "uint16",
+	"Uint32":  "uint32",
+}
+
+type generator struct {
+	schema  *dfuse.GraphQLSchema
+	scalars map[string]string
+
+	imports map[string]bool
+	types   *bytes.Buffer
+	emitted map[string]bool
+	body    *bytes.Buffer
+
+	// declared maps the Go names declared by the generated code to what they were declared for,
+	// operations, enums and inputs sharing the package's namespace
+	declared map[string]string
+}
+
+// generate returns the Go code, in package `packageName`, of the operations defined in `files`,
+// checked against `schema`. `scalars` maps custom scalars to Go types, either a builtin type or
+// a package qualified one like `time.Time` or `math/big.Int`.
+func generate(ctx context.Context, schema *dfuse.GraphQLSchema, packageName string, scalars map[string]string, files []string) ([]byte, error) {
+	g := &generator{
+		schema:  schema,
+		scalars: map[string]string{},
+		imports: map[string]bool{"context": true, "github.com/streamingfast/client-go": true},
+		types:   bytes.NewBuffer(nil),
+		emitted: map[string]bool{},
+		body:    bytes.NewBuffer(nil),
+
+		declared: map[string]string{},
+	}
+
+	for name, goType := range builtinScalars {
+		g.scalars[name] = goType
+	}
+
+	for name, goType := range scalars {
+		g.scalars[name] = goType
+	}
+
+	operationFiles := map[string]string{}
+	for _, file := range files {
+		document, err := dfuse.GraphQLFileDocument(file).Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", file, err)
+		}
+
+		if err := schema.Validate(document, nil, ""); err != nil {
+			return nil, locatedError(file, err)
+		}
+
+		parsed, err := parser.ParseQuery(&ast.Source{Name: file, Input: document})
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+
+		// Validation annotates the document with the definitions of its fields and fragments
+		validator.Validate(schema.Schema, parsed)
+
+		for _, operation := range parsed.Operations {
+			if operation.Name == "" {
+				return nil, fmt.Errorf("%s:%d:%d: operations must be named to generate code", file, operation.Position.Line, operation.Position.Column)
+			}
+
+			if previous, found := operationFiles[operation.Name]; found {
+				return nil, fmt.Errorf("%s: operation %q already defined in %s", file, operation.Name, previous)
+			}
+
+			operationFiles[operation.Name] = file
+			if err := g.generateOperation(operation); err != nil {
+				return nil, fmt.Errorf("%s: operation %s: %w", file, operation.Name, err)
+			}
+		}
+	}
+
+	out := bytes.NewBuffer(nil)
+	fmt.Fprintf(out, "// Code generated by dgql-gen, DO NOT EDIT.\n\npackage %s\n\n", packageName)
+
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+
+	// Standard library imports first, like goimports does
+	sort.SliceStable(imports, func(i, j int) bool { return isStandardImport(imports[i]) && !isStandardImport(imports[j]) })
+
+	out.WriteString("import (\n")
+	for i, path := range imports {
+		if i > 0 && isStandardImport(imports[i-1]) && !isStandardImport(path) {
+			out.WriteString("\n")
+		}
+
+		if path == "github.com/streamingfast/client-go" {
+			fmt.Fprintf(out, "\tdfuse %q\n", path)
+		} else {
+			fmt.Fprintf(out, "\t%q\n", path)
+		}
+	}
+	out.WriteString(")\n")
+
+	out.Write(g.body.Bytes())
+	out.Write(g.types.Bytes())
+
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+
+	return formatted, nil
+}
+
+func (g *generator) generateOperation(operation *ast.OperationDefinition) error {
+	name := goName(operation.Name)
+
+	declared := []string{name, name + "Document", name + "Response"}
+	if len(operation.VariableDefinitions) > 0 {
+		declared = append(declared, name+"Variables")
+	}
+
+	if operation.Operation == ast.Subscription {
+		declared = append(declared, name+"Stream")
+	}
+
+	if err := g.declare(fmt.Sprintf("%s `%s`", operation.Operation, operation.Name), declared...); err != nil {
+		return err
+	}
+
+	document := bytes.NewBuffer(nil)
+	formatter.NewFormatter(document, formatter.WithIndent("  ")).FormatQueryDocument(&ast.QueryDocument{
+		Operations: ast.OperationList{operation},
+		Fragments:  usedFragments(operation.SelectionSet),
+	})
+
+	fmt.Fprintf(g.body, "\n// %sDocument is the document of the `%s` %s.\n", name, operation.Name, operation.Operation)
+	fmt.Fprintf(g.body, "const %sDocument = %s\n", name, goString(document.String()))
+
+	hasVariables := len(operation.VariableDefinitions) > 0
+	if hasVariables {
+		fmt.Fprintf(g.body, "\n// %sVariables are the variables of the `%s` %s.\n", name, operation.Name, operation.Operation)
+		fmt.Fprintf(g.body, "type %sVariables struct {\n", name)
+		for _, variable := range operation.VariableDefinitions {
+			goType, err := g.inputType(variable.Type)
+			if err != nil {
+				return fmt.Errorf("variable %s: %w", variable.Variable, err)
+			}
+
+			fmt.Fprintf(g.body, "%s %s `json:\"%s%s\"`\n", goName(variable.Variable), goType, variable.Variable, omitEmpty(variable.Type))
+		}
+		g.body.WriteString("}\n")
+	}
+
+	root := g.schema.Query
+	switch operation.Operation {
+	case ast.Mutation:
+		root = g.schema.Mutation
+	case ast.Subscription:
+		root = g.schema.Subscription
+	}
+
+	if root == nil {
+		return fmt.Errorf("schema does not define %s operations", operation.Operation)
+	}
+
+	responseType, err := g.selectionType(operation.SelectionSet)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(g.body, "\n// %sResponse is the data of the `%s` %s's response.\n", name, operation.Name, operation.Operation)
+	fmt.Fprintf(g.body, "type %sResponse %s\n", name, responseType)
+
+	parameters, options := "", "opts..."
+	if hasVariables {
+		parameters = fmt.Sprintf(", variables *%sVariables", name)
+		options = "append([]dfuse.GraphQLOption{dfuse.GraphQLVariablesOf(variables)}, opts...)..."
+	}
+
+	if operation.Operation == ast.Subscription {
+		g.imports["io"] = true
+		fmt.Fprintf(g.body, `
+// %[1]s performs the `+"`%[2]s`"+` subscription, see `+"`%[1]sStream`"+`.
+func %[1]s(ctx context.Context, client dfuse.Client%[3]s, opts ...dfuse.GraphQLOption) (%[1]sStream, error) {
+	stream, err := client.GraphQLTypedSubscription(ctx, %[1]sDocument, %[4]s)
+	if err != nil {
+		return %[1]sStream{}, err
+	}
+
+	return %[1]sStream{stream: stream}, nil
+}
+
+// %[1]sStream is the stream of the `+"`%[2]s`"+` subscription.
+type %[1]sStream struct {
+	stream dfuse.GraphQLTypedStream
+}
+
+// Recv receives the next message of the subscription, see `+"`dfuse.GraphQLTypedStream`"+`.
+func (s %[1]sStream) Recv() (*%[1]sResponse, error) {
+	out := &%[1]sResponse{}
+	if err := s.stream.Recv(out); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		return out, err
+	}
+
+	return out, nil
+}
+
+// Stream returns the underlying stream.
+func (s %[1]sStream) Stream() dfuse.GraphQLStream {
+	return s.stream.Stream()
+}
+`, name, operation.Name, parameters, options)
+
+		return nil
+	}
+
+	fmt.Fprintf(g.body, `
+// %[1]s performs the `+"`%[2]s`"+` %[5]s, see `+"`dfuse.Client.GraphQLQueryInto`"+`.
+func %[1]s(ctx context.Context, client dfuse.Client%[3]s, opts ...dfuse.GraphQLOption) (*%[1]sResponse, error) {
+	out := &%[1]sResponse{}
+	err := client.GraphQLQueryInto(ctx, %[1]sDocument, out, %[4]s)
+	return out, err
+}
+`, name, operation.Name, parameters, options, operation.Operation)
+
+	return nil
+}
+
+// selectionType returns the Go struct type of `selections`, the fields selected through
+// fragments (inline or named) being merged with the others.
+func (g *generator) selectionType(selections ast.SelectionSet) (string, error) {
+	var fields []*ast.Field
+	merged := map[string]*ast.Field{}
+	if err := collectFields(selections, &fields, merged); err != nil {
+		return "", err
+	}
+
+	out := &strings.Builder{}
+	out.WriteString("struct {\n")
+	for _, field := range fields {
+		goType, err := g.outputType(field.Definition.Type, field.SelectionSet)
+		if err != nil {
+			return "", fmt.Errorf("field %s: %w", field.Alias, err)
+		}
+
+		fmt.Fprintf(out, "%s %s `json:\"%s\"`\n", goName(field.Alias), goType, field.Alias)
+	}
+	out.WriteString("}")
+
+	return out.String(), nil
+}
+
+// collectFields flattens `selections` in `fields`, the selections of fields with the same
+// response key being merged. Fields with the same response key but different types (selected on
+// different members of a union or interface) can't share a Go field and are reported as an error.
+func collectFields(selections ast.SelectionSet, fields *[]*ast.Field, merged map[string]*ast.Field) error {
+	for _, selection := range selections {
+		var err error
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if existing, found := merged[selection.Alias]; found {
+				if existingType, fieldType := existing.Definition.Type.String(), selection.Definition.Type.String(); existingType != fieldType {
+					return fmt.Errorf("field %s: conflicting types %s (%s) and %s (%s)", selection.Alias, existingType, existing.Name, fieldType, selection.Name)
+				}
+
+				existing.SelectionSet = append(existing.SelectionSet, selection.SelectionSet...)
+				continue
+			}
+
+			field := *selection
+			field.SelectionSet = append(ast.SelectionSet(nil), selection.SelectionSet...)
+			merged[field.Alias] = &field
+			*fields = append(*fields, &field)
+		case *ast.InlineFragment:
+			err = collectFields(selection.SelectionSet, fields, merged)
+		case *ast.FragmentSpread:
+			err = collectFields(selection.Definition.SelectionSet, fields, merged)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) outputType(typ *ast.Type, selections ast.SelectionSet) (string, error) {
+	if typ.Elem != nil {
+		elem, err := g.outputType(typ.Elem, selections)
+		return "[]" + elem, err
+	}
+
+	definition := g.schema.Types[typ.NamedType]
+	switch definition.Kind {
+	case ast.Scalar:
+		return g.scalarType(definition.Name), nil
+	case ast.Enum:
+		return g.enumType(definition)
+	default:
+		structType, err := g.selectionType(selections)
+		if err != nil {
+			return "", err
+		}
+
+		if !typ.NonNull {
+			return "*" + structType, nil
+		}
+
+		return structType, nil
+	}
+}
+
+func (g *generator) inputType(typ *ast.Type) (string, error) {
+	if typ.Elem != nil {
+		elem, err := g.inputType(typ.Elem)
+		return "[]" + elem, err
+	}
+
+	definition := g.schema.Types[typ.NamedType]
+
+	var goType string
+	switch definition.Kind {
+	case ast.Scalar:
+		goType = g.scalarType(definition.Name)
+	case ast.Enum:
+		var err error
+		if goType, err = g.enumType(definition); err != nil {
+			return "", err
+		}
+	case ast.InputObject:
+		if err := g.inputObjectType(definition); err != nil {
+			return "", err
+		}
+
+		goType = goName(definition.Name)
+	default:
+		return "", fmt.Errorf("type %s is not an input type", definition.Name)
+	}
+
+	if !typ.NonNull {
+		return "*" + goType, nil
+	}
+
+	return goType, nil
+}
+
+func (g *generator) inputObjectType(definition *ast.Definition) error {
+	if g.emitted[definition.Name] {
+		return nil
+	}
+
+	g.emitted[definition.Name] = true
+
+	if err := g.declare(fmt.Sprintf("input `%s`", definition.Name), goName(definition.Name)); err != nil {
+		return err
+	}
+
+	out := &strings.Builder{}
+	writeTypeComment(out, definition)
+	fmt.Fprintf(out, "type %s struct {\n", goName(definition.Name))
+	for _, field := range definition.Fields {
+		goType, err := g.inputType(field.Type)
+		if err != nil {
+			return fmt.Errorf("input %s field %s: %w", definition.Name, field.Name, err)
+		}
+
+		fmt.Fprintf(out, "%s %s `json:\"%s%s\"`\n", goName(field.Name), goType, field.Name, omitEmpty(field.Type))
+	}
+	out.WriteString("}\n")
+
+	g.types.WriteString(out.String())
+	return nil
+}
+
+func (g *generator) enumType(definition *ast.Definition) (string, error) {
+	name := goName(definition.Name)
+	if g.emitted[definition.Name] {
+		return name, nil
+	}
+
+	g.emitted[definition.Name] = true
+
+	declared := []string{name}
+	for _, value := range definition.EnumValues {
+		declared = append(declared, name+goName(strings.ToLower(value.Name)))
+	}
+
+	if err := g.declare(fmt.Sprintf("enum `%s`", definition.Name), declared...); err != nil {
+		return "", err
+	}
+
+	writeTypeComment(g.types, definition)
+	fmt.Fprintf(g.types, "type %s string\n\nconst (\n", name)
+	for _, value := range definition.EnumValues {
+		fmt.Fprintf(g.types, "%s%s %s = %q\n", name, goName(strings.ToLower(value.Name)), name, value.Name)
+	}
+	g.types.WriteString(")\n")
+
+	return name, nil
+}
+
+// declare records the Go `names` declared for `origin`, failing when one of them is already
+// declared for something else (like the `BlockStatus` enum and a `BlockStatus` query).
+func (g *generator) declare(origin string, names ...string) error {
+	for _, name := range names {
+		if previous, found := g.declared[name]; found {
+			return fmt.Errorf("Go name %s of %s clashes with the one of %s", name, origin, previous)
+		}
+	}
+
+	for _, name := range names {
+		g.declared[name] = origin
+	}
+
+	return nil
+}
+
+// scalarType returns the Go type of scalar `name`, importing its package if needed.
+func (g *generator) scalarType(name string) string {
+	goType, found := g.scalars[name]
+	if !found {
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+
+	// Package qualified type, like `time.Time` or `math/big.Int`
+	if dot := strings.LastIndex(goType, "."); dot > 0 {
+		path := strings.TrimPrefix(goType[:dot], "*")
+		g.imports[path] = true
+
+		pointer := ""
+		if strings.HasPrefix(goType, "*") {
+			pointer = "*"
+		}
+
+		return pointer + path[strings.LastIndex(path, "/")+1:] + goType[dot:]
+	}
+
+	return goType
+}
+
+func isStandardImport(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// usedFragments returns the fragments referenced by `selections`, directly or not.
+func usedFragments(selections ast.SelectionSet) (out ast.FragmentDefinitionList) {
+	seen := map[string]bool{}
+
+	var visit func(selections ast.SelectionSet)
+	visit = func(selections ast.SelectionSet) {
+		for _, selection := range selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				visit(selection.SelectionSet)
+			case *ast.InlineFragment:
+				visit(selection.SelectionSet)
+			case *ast.FragmentSpread:
+				if !seen[selection.Name] {
+					seen[selection.Name] = true
+					out = append(out, selection.Definition)
+					visit(selection.Definition.SelectionSet)
+				}
+			}
+		}
+	}
+
+	visit(selections)
+	return out
+}
+
+func locatedError(file string, err error) error {
+	var validationErr *dfuse.ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	messages := make([]string, len(validationErr.Errors))
+	for i, graphqlErr := range validationErr.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", file, graphqlErr)
+		if len(graphqlErr.Locations) > 0 {
+			messages[i] = fmt.Sprintf("%s:%d:%d: %s", file, graphqlErr.Locations[0].Line, graphqlErr.Locations[0].Column, graphqlErr)
+		}
+	}
+
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// commonInitialisms are written in upper case in Go names, like `ID` or `URL`
+var commonInitialisms = map[string]bool{"Id": true, "Url": true, "Api": true, "Json": true, "Http": true}
+
+// goName returns the exported Go name of GraphQL name `name`, `block_num` becoming `BlockNum`.
+func goName(name string) string {
+	out := &strings.Builder{}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' }) {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+
+		word := string(runes)
+		for initialism := range commonInitialisms {
+			if strings.HasSuffix(word, initialism) {
+				word = strings.TrimSuffix(word, initialism) + strings.ToUpper(initialism)
+				break
+			}
+		}
+
+		out.WriteString(word)
+	}
+
+	if out.Len() == 0 {
+		return "X"
+	}
+
+	return out.String()
+}
+
+func omitEmpty(typ *ast.Type) string {
+	if typ.NonNull {
+		return ""
+	}
+
+	return ",omitempty"
+}
+
+// writeTypeComment writes the doc comment of the Go type of `definition`, with its description.
+func writeTypeComment(out interface{ WriteString(string) (int, error) }, definition *ast.Definition) {
+	kind := "enum"
+	if definition.Kind == ast.InputObject {
+		kind = "input"
+	}
+
+	out.WriteString(fmt.Sprintf("\n// %s is the `%s` GraphQL %s.", goName(definition.Name), definition.Name, kind))
+	if description := strings.TrimSpace(definition.Description); description != "" {
+		out.WriteString("\n//\n// " + strings.Join(strings.Split(description, "\n"), "\n// "))
+	}
+
+	out.WriteString("\n")
+}
+
+// goString returns `in` as a Go string literal, a raw one when possible for readability.
+func goString(in string) string {
+	if !strings.Contains(in, "`") {
+		return "`" + in + "`"
+	}
+
+	return strconv.Quote(in)
+}
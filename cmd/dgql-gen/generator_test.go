@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	dfuse "github.com/streamingfast/client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `
+schema { query: Query subscription: Subscription }
+scalar Uint32
+scalar Uint64
+type Block { id: String! number: Uint32! status: BlockStatus producer_name: String transfers: [Transfer!]! }
+enum BlockStatus { IRREVERSIBLE NOT_FOUND }
+type Query { block(num: Uint32!): Block blocks(limit: Int = 10): [Block!]! }
+type Subscription { transfers(filter: TransferFilter!, cursor: String): TransferEvent! }
+type TransferEvent { cursor: String! transfer: Transfer }
+type TokenTransfer { amount: Uint64 block: Block }
+type NativeTransfer { value: Uint64 from: String event: TransferEvent }
+union Transfer = TokenTransfer | NativeTransfer
+"""Filters transfers."""
+input TransferFilter { from: [String!] minimum: Int = 0 status: BlockStatus }
+`
+
+func TestGenerate(t *testing.T) {
+	schema, err := dfuse.NewGraphQLSchemaFromSDL(testSchema)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		files       map[string]string
+		scalars     map[string]string
+		expected    []string
+		expectedErr string
+	}{
+		{
+			"query with fragment import",
+			map[string]string{
+				"block.graphql":     "#import \"fragments.graphql\"\nquery Block($num: Uint32!) { block(num: $num) { id status producer_name ...Transfers } }",
+				"fragments.graphql": "fragment Transfers on Block { transfers { ... on TokenTransfer { amount } } }",
+			},
+			map[string]string{"Uint64": "math/big.Int"},
+			[]string{
+				"\t\"math/big\"\n\n\tdfuse \"github.com/streamingfast/client-go\"\n",
+				"const BlockDocument = `query Block ($num: Uint32!) {\n",
+				"fragment Transfers on Block {\n",
+				"type BlockVariables struct {\n\tNum uint32 `json:\"num\"`\n}",
+				"\tBlock *struct {\n\t\tID           string      `json:\"id\"`\n\t\tStatus       BlockStatus `json:\"status\"`\n\t\tProducerName string      `json:\"producer_name\"`\n\t\tTransfers    []struct {\n\t\t\tAmount big.Int `json:\"amount\"`\n\t\t} `json:\"transfers\"`\n\t} `json:\"block\"`",
+				"func Block(ctx context.Context, client dfuse.Client, variables *BlockVariables, opts ...dfuse.GraphQLOption) (*BlockResponse, error) {",
+				"\terr := client.GraphQLQueryInto(ctx, BlockDocument, out, append([]dfuse.GraphQLOption{dfuse.GraphQLVariablesOf(variables)}, opts...)...)",
+				"type BlockStatus string",
+				"\tBlockStatusNotFound     BlockStatus = \"NOT_FOUND\"",
+			},
+			"",
+		},
+		{
+			"subscription with union and input",
+			map[string]string{
+				"transfers.graphql": "subscription Transfers($filter: TransferFilter!) { transfers(filter: $filter) { cursor transfer { __typename ... on TokenTransfer { amount } ... on NativeTransfer { value from } } } }",
+			},
+			nil,
+			[]string{
+				"type TransfersVariables struct {\n\tFilter TransferFilter `json:\"filter\"`\n}",
+				"\t\tTransfer *struct {\n\t\t\tTypename string          `json:\"__typename\"`\n\t\t\tAmount   json.RawMessage `json:\"amount\"`\n\t\t\tValue    json.RawMessage `json:\"value\"`\n\t\t\tFrom     string          `json:\"from\"`\n\t\t} `json:\"transfer\"`",
+				"func Transfers(ctx context.Context, client dfuse.Client, variables *TransfersVariables, opts ...dfuse.GraphQLOption) (TransfersStream, error) {",
+				"func (s TransfersStream) Recv() (*TransfersResponse, error) {",
+				"// TransferFilter is the `TransferFilter` GraphQL input.\n//\n// Filters transfers.\ntype TransferFilter struct {\n\tFrom    []string     `json:\"from,omitempty\"`\n\tMinimum *int         `json:\"minimum,omitempty\"`\n\tStatus  *BlockStatus `json:\"status,omitempty\"`\n}",
+			},
+			"",
+		},
+		{
+			"query without variables",
+			map[string]string{"latest.graphql": "query Latest { blocks { id } }"},
+			nil,
+			[]string{
+				"func Latest(ctx context.Context, client dfuse.Client, opts ...dfuse.GraphQLOption) (*LatestResponse, error) {\n\tout := &LatestResponse{}\n\terr := client.GraphQLQueryInto(ctx, LatestDocument, out, opts...)",
+			},
+			"",
+		},
+		{"invalid document", map[string]string{"bad.graphql": "query Bad {\n  blocks { hash }\n}"}, nil, nil, `bad.graphql:2:12: Cannot query field "hash" on type "Block".`},
+		{"anonymous operation", map[string]string{"anonymous.graphql": "{ blocks { id } }"}, nil, nil, "anonymous.graphql:1:1: operations must be named to generate code"},
+		{"operation clashing with enum", map[string]string{"status.graphql": "query BlockStatus { blocks { status } }"}, nil, nil, "Go name BlockStatus of enum `BlockStatus` clashes with the one of query `BlockStatus`"},
+		{"operation clashing with input", map[string]string{"filter.graphql": "subscription Transfer($filter: TransferFilter!) { transfers(filter: $filter) { cursor } }\nquery TransferFilter { blocks { id } }"}, nil, nil, "filter.graphql: operation TransferFilter: Go name TransferFilter of query `TransferFilter` clashes with the one of input `TransferFilter`"},
+		{
+			"union members with conflicting scalar types",
+			map[string]string{"transfers.graphql": "query Transfers { blocks { transfers { ... on TokenTransfer { v: amount } ... on NativeTransfer { v: from } } } }"},
+			nil,
+			nil,
+			`Fields "v" conflict because they return conflicting types "Uint64" and "String".`,
+		},
+		{
+			"union members with conflicting object types",
+			map[string]string{"transfers.graphql": "query Transfers { blocks { transfers { ... on TokenTransfer { v: block { id } } ... on NativeTransfer { v: event { cursor } } } } }"},
+			nil,
+			nil,
+			"transfers.graphql: operation Transfers: field blocks: field transfers: field v: conflicting types Block (block) and TransferEvent (event)",
+		},
+		{"operation clashing with enum value", map[string]string{"status.graphql": "query BlockStatusNotFound { blocks { status } }"}, nil, nil, "Go name BlockStatusNotFound of enum `BlockStatus` clashes with the one of query `BlockStatusNotFound`"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var files []string
+			for name, content := range test.files {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+				if name != "fragments.graphql" {
+					files = append(files, filepath.Join(dir, name))
+				}
+			}
+
+			generated, err := generate(context.Background(), schema, "operations", test.scalars, files)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			for _, expected := range test.expected {
+				assert.Contains(t, string(generated), expected)
+			}
+		})
+	}
+}
+
+func TestGenerate_Compiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building generated code is skipped in short mode")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not found")
+	}
+
+	schema, err := dfuse.NewGraphQLSchemaFromSDL(testSchema)
+	require.NoError(t, err)
+
+	sources := t.TempDir()
+	files := map[string]string{
+		"block.graphql":     "#import \"fragments.graphql\"\nquery Block($num: Uint32!) { block(num: $num) { id status producer_name ...Transfers } }",
+		"fragments.graphql": "fragment Transfers on Block { transfers { ... on TokenTransfer { amount } } }",
+		"transfers.graphql": "subscription Transfers($filter: TransferFilter!) { transfers(filter: $filter) { cursor transfer { __typename ... on TokenTransfer { amount } ... on NativeTransfer { value from } } } }",
+		"latest.graphql":    "query Latest { blocks { id } }",
+	}
+
+	var paths []string
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(sources, name), []byte(content), 0644))
+		if name != "fragments.graphql" {
+			paths = append(paths, filepath.Join(sources, name))
+		}
+	}
+
+	generated, err := generate(context.Background(), schema, "operations", map[string]string{"Uint64": "math/big.Int"}, paths)
+	require.NoError(t, err)
+
+	// Within the module for the generated code to import the client, ignored by `./...` patterns
+	dir, err := ioutil.TempDir(".", "_generated")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "operations_gen.go"), generated, 0644))
+
+	for _, command := range [][]string{{"build", "./" + dir}, {"vet", "./" + dir}} {
+		out, err := exec.Command("go", command...).CombinedOutput()
+		require.NoError(t, err, "go %s: %s", command[0], out)
+	}
+}
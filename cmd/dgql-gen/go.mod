@@ -0,0 +1,13 @@
+module github.com/streamingfast/client-go/cmd/dgql-gen
+
+go 1.16
+
+require (
+	github.com/spf13/cobra v1.3.0
+	github.com/streamingfast/cli v0.0.3
+	github.com/streamingfast/client-go v0.1.1-0.20220305041752-ea54f92afacd
+	github.com/stretchr/testify v1.7.1
+	github.com/vektah/gqlparser/v2 v2.5.1
+)
+
+replace github.com/streamingfast/client-go => ../../
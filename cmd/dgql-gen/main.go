@@ -0,0 +1,193 @@
+// Command dgql-gen generates Go types and functions for the GraphQL operations defined in
+// `.graphql` files, checked against the schema of a dfuse endpoint.
+//
+// For each named operation, it generates the operation's document (`<Name>Document`), the type of
+// its variables (`<Name>Variables`), the type of its response's data (`<Name>Response`) and a
+// function performing it through a `dfuse.Client`: queries and mutations return the decoded
+// response, subscriptions return a `<Name>Stream` decoding each message.
+//
+// Usage:
+//
+//	dgql-gen --endpoint eos-mainnet --package eosql --out operations_gen.go queries/*.graphql
+//	dgql-gen --schema schema.graphql --scalar Uint64=string --package ethql --out - operations.graphql
+//
+// The schema is either introspected from the endpoint given by `--endpoint` (authenticated with
+// the API key given by `--api-key` or the `DFUSE_API_KEY` environment variable, cached like for
+// `dgql schema`) or read from the file given by `--schema` (SDL or introspection JSON).
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/cli"
+	dfuse "github.com/streamingfast/client-go"
+)
+
+var cmd = &cobra.Command{
+	Use:   "dgql-gen (--endpoint <endpoint> | --schema <file>) <file.graphql>...",
+	Short: "Generate Go types and functions for GraphQL operations checked against a dfuse schema.",
+	Args:  cobra.MinimumNArgs(1),
+	Long: cobraDescription(`
+		Generate Go code for the named operations defined in the GraphQL documents <file.graphql>,
+		checked against a schema, either the one of the endpoint given by --endpoint (introspected,
+		see 'dgql schema') or the one read from the file given by --schema (in SDL or introspection
+		JSON).
+
+		For each operation, the operation's document, the types of its variables and of its
+		response's data and a function performing it through a 'dfuse.Client' are generated.
+		Subscriptions return a typed stream decoding each message.
+
+		Custom scalars are represented by the Go types given by --scalar, json.RawMessage otherwise.
+	`),
+	Example: cobraExamples(
+		`dgql-gen --endpoint eos-mainnet --package eosql --out operations_gen.go queries/*.graphql`,
+		`dgql-gen --schema schema.graphql --scalar Uint64=string --package ethql --out - operations.graphql`,
+	),
+	SilenceErrors: false,
+	SilenceUsage:  true,
+	RunE:          dgqlGenE,
+}
+
+var flagEndpoint *string
+var flagAPIKey *string
+var flagSchema *string
+var flagPackage *string
+var flagOut *string
+var flagScalars *[]string
+
+func main() {
+	flagEndpoint = cmd.Flags().StringP("endpoint", "e", "", "The endpoint whose schema is introspected to generate the code")
+	flagAPIKey = cmd.Flags().StringP("api-key", "a", "", "The dfuse API key used to introspect the endpoint's schema, if empty, checks environment variable DFUSE_API_KEY, if it's also empty, assumes the endpoint is not authenticated")
+	flagSchema = cmd.Flags().StringP("schema", "s", "", "The schema file (SDL or introspection JSON) used to generate the code, instead of an endpoint's schema")
+	flagPackage = cmd.Flags().StringP("package", "p", "", "The package of the generated code, defaults to the name of the output file's directory")
+	flagOut = cmd.Flags().StringP("out", "o", "operations_gen.go", "The file the generated code is written to, '-' for standard output")
+	flagScalars = cmd.Flags().StringArray("scalar", nil, "A mapping of a custom scalar to the Go type representing it, like 'Uint64=string' or 'Time=time.Time' (repeatable), unmapped custom scalars are represented as json.RawMessage")
+
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func dgqlGenE(cmd *cobra.Command, args []string) error {
+	ensureArgument(cmd, (*flagEndpoint == "") != (*flagSchema == ""), "Exactly one of --endpoint or --schema must be specified")
+
+	scalars, err := readScalars(*flagScalars)
+	if err != nil {
+		return err
+	}
+
+	packageName := *flagPackage
+	if packageName == "" {
+		packageName = defaultPackageName(*flagOut)
+	}
+
+	apiKey := *flagAPIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("DFUSE_API_KEY")
+	}
+
+	schema, err := loadSchema(cmd.Context(), *flagEndpoint, apiKey, *flagSchema)
+	if err != nil {
+		return fmt.Errorf("unable to load schema: %w", err)
+	}
+
+	generated, err := generate(cmd.Context(), schema, packageName, scalars, args)
+	if err != nil {
+		return err
+	}
+
+	if *flagOut == "-" {
+		_, err := os.Stdout.Write(generated)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*flagOut, generated, 0644); err != nil {
+		return fmt.Errorf("unable to write generated code: %w", err)
+	}
+
+	return nil
+}
+
+// readScalars reads the `<scalar>=<go type>` mappings of custom scalars given by --scalar
+func readScalars(mappings []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid scalar mapping %q, expected <scalar>=<go type>", mapping)
+		}
+
+		out[parts[0]] = parts[1]
+	}
+
+	return out, nil
+}
+func loadSchema(ctx context.Context, endpoint string, apiKey string, schemaFile string) (*dfuse.GraphQLSchema, error) {
+	if schemaFile != "" {
+		content, err := ioutil.ReadFile(schemaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+			return dfuse.NewGraphQLSchema(content)
+		}
+
+		return dfuse.NewGraphQLSchemaFromSDL(string(content))
+	}
+
+	var options []dfuse.ClientOption
+	if apiKey == "" {
+		options = append(options, dfuse.WithoutAuthentication())
+	}
+
+	client, err := dfuse.NewClient(endpoint, apiKey, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.GraphQLSchema(ctx)
+}
+
+func defaultPackageName(out string) string {
+	dir := "."
+	if out != "-" {
+		dir = filepath.Dir(out)
+	}
+
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return "main"
+	}
+
+	return strings.NewReplacer("-", "", ".", "").Replace(filepath.Base(absolute))
+}
+
+func ensureArgument(cmd *cobra.Command, condition bool, message string, args ...interface{}) {
+	if !condition {
+		fmt.Printf("invalid arguments: "+message+"\n", args...)
+		fmt.Println()
+
+		cmd.Help()
+		os.Exit(1)
+	}
+}
+
+func cobraDescription(in string) string {
+	return cli.Dedent(strings.Trim(in, "\n"))
+}
+
+func cobraExamples(in ...string) string {
+	for i, line := range in {
+		in[i] = "  " + line
+	}
+
+	return strings.Join(in, "\n")
+}
@@ -3,19 +3,13 @@ module github.com/streamingfast/client-go/cmd/dgql
 go 1.16
 
 require (
-	cloud.google.com/go/compute v1.5.0 // indirect
 	github.com/lithammer/dedent v1.1.0
 	github.com/manifoldco/promptui v0.9.0 // indirect
 	github.com/spf13/cobra v1.3.0
 	github.com/streamingfast/cli v0.0.3
 	github.com/streamingfast/client-go v0.1.1-0.20220305041752-ea54f92afacd
-	github.com/streamingfast/dgrpc v0.0.0-20210811180351-8646818518b2 // indirect
 	github.com/streamingfast/logging v0.0.0-20220304214715-bc750a74b424
-	go.uber.org/atomic v1.9.0 // indirect
-	go.uber.org/multierr v1.8.0 // indirect
 	go.uber.org/zap v1.21.0
-	golang.org/x/net v0.0.0-20220225172249-27dd8689420f // indirect
-	golang.org/x/oauth2 v0.0.0-20220223155221-ee480838109b // indirect
-	golang.org/x/sys v0.0.0-20220227234510-4e6760a101f9 // indirect
-	google.golang.org/genproto v0.0.0-20220304144024-325a89244dc8 // indirect
 )
+
+replace github.com/streamingfast/client-go => ../../
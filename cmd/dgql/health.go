@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	dfuse "github.com/streamingfast/client-go"
+	"go.uber.org/zap"
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health <endpoint> [<service>]",
+	Short: "Check the health of a dfuse endpoint using the standard gRPC health checking protocol.",
+	Args:  cobra.RangeArgs(1, 2),
+	Long: cobraDescription(`
+		Check the health of the gRPC <endpoint> using the standard 'grpc.health.v1.Health' service,
+		for the GraphQL service ('sf.graphql.v1.GraphQL') by default or for the given <service>
+		(use '' to check the server as a whole).
+
+		The serving status is printed to standard output and the command exits with code 0 when
+		the service is SERVING, 1 when the endpoint could not be reached and 2 when the endpoint
+		was reached but the service is not serving.
+	`),
+	Example: cobraExamples(
+		`dgql health eos-mainnet`,
+		`dgql health grpc://localhost:9000 ''`,
+	),
+	SilenceErrors: false,
+	SilenceUsage:  true,
+	RunE:          healthE,
+}
+
+func healthE(cmd *cobra.Command, args []string) error {
+	config := &config{Endpoint: args[0]}
+	config.resolveConnection(cmd)
+
+	service := dfuse.GraphQLHealthService
+	if len(args) == 2 {
+		service = args[1]
+	}
+
+	zlog.Info("performing health check", zap.Reflect("config", config), zap.String("service", service))
+
+	client := newClient(config)
+	defer client.Close()
+
+	status, err := client.HealthCheck(cmd.Context(), service)
+	if err != nil {
+		return fmt.Errorf("unable to check health of endpoint: %w", err)
+	}
+
+	fmt.Println(status)
+	if status != dfuse.HealthStatusServing {
+		return &exitError{code: 2, err: fmt.Errorf("service %q is not serving", service)}
+	}
+
+	return nil
+}
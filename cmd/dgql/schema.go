@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	dfuse "github.com/streamingfast/client-go"
+	"go.uber.org/zap"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema <endpoint>",
+	Short: "Print the GraphQL schema of a dfuse endpoint in GraphQL Schema Definition Language.",
+	Args:  cobra.ExactArgs(1),
+	Long: cobraDescription(`
+		Print the GraphQL schema of the <endpoint>, retrieved through the standard introspection
+		query, in GraphQL Schema Definition Language (SDL).
+
+		The schema is cached per endpoint in '~/.dfuse/schemas' for a day, use --no-cache to
+		introspect the endpoint regardless of the cache (the cache is then left untouched).
+	`),
+	Example: cobraExamples(
+		`dgql schema eos-mainnet`,
+		`dgql schema --no-cache grpc://localhost:9000 > schema.graphql`,
+	),
+	SilenceErrors: false,
+	SilenceUsage:  true,
+	RunE:          schemaE,
+}
+
+var flagSchemaNoCache *bool
+
+func init() {
+	flagSchemaNoCache = schemaCmd.Flags().Bool("no-cache", false, "Introspect the endpoint without reading nor writing the on-disk schema cache")
+}
+
+func schemaE(cmd *cobra.Command, args []string) error {
+	config := &config{Endpoint: args[0]}
+	config.resolveConnection(cmd)
+
+	zlog.Info("retrieving graphql schema", zap.Reflect("config", config), zap.Bool("no_cache", *flagSchemaNoCache))
+
+	var options []dfuse.ClientOption
+	if *flagSchemaNoCache {
+		options = append(options, dfuse.WithSchemaCache("", 0))
+	}
+
+	client := newClient(config, options...)
+	defer client.Close()
+
+	schema, err := client.GraphQLSchema(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("unable to retrieve schema of endpoint: %w", err)
+	}
+
+	fmt.Print(schema.SDL())
+	return nil
+}
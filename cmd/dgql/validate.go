@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	dfuse "github.com/streamingfast/client-go"
+	"go.uber.org/zap"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <file> [<variables>]",
+	Short: "Validate a GraphQL document and its variables against the schema of a dfuse endpoint.",
+	Args:  cobra.RangeArgs(1, 2),
+	Long: cobraDescription(`
+		Validate the GraphQL document <file> and its <variables> (if present) against a schema,
+		either the one of the endpoint given by --endpoint (introspected, see 'dgql schema') or
+		the one read from the file given by --schema (in SDL or introspection JSON), without
+		sending the document.
+
+		Unknown fields, wrong argument types, missing required variables and scalar mismatches are
+		printed to standard output, one per line, prefixed by their line and column in the document,
+		the command then exits with a non-zero code.
+	`),
+	Example: cobraExamples(
+		`dgql validate --endpoint eos-mainnet stream_transactions.graphql '{"query":"something:true"}'`,
+		`dgql validate --schema schema.graphql --operation Transfers operations.graphql`,
+	),
+	SilenceErrors: false,
+	SilenceUsage:  true,
+	RunE:          validateE,
+}
+
+var flagValidateEndpoint *string
+var flagValidateSchema *string
+var flagValidateOperation *string
+
+func init() {
+	flagValidateEndpoint = validateCmd.Flags().StringP("endpoint", "e", "", "The endpoint whose schema the document is validated against")
+	flagValidateSchema = validateCmd.Flags().StringP("schema", "s", "", "The schema file (SDL or introspection JSON) the document is validated against, instead of an endpoint's schema")
+	flagValidateOperation = validateCmd.Flags().StringP("operation", "o", "", "The name of the operation whose variables are validated when the GraphQL document defines multiple operations")
+}
+
+func validateE(cmd *cobra.Command, args []string) error {
+	ensureArgument(cmd, (*flagValidateEndpoint == "") != (*flagValidateSchema == ""), "Exactly one of --endpoint or --schema must be specified")
+
+	filename := args[0]
+	document := readGraphQLDocument(cmd, filename)
+
+	rawVariables := ""
+	if len(args) == 2 {
+		rawVariables = args[1]
+	}
+
+	variables, err := readVariables(rawVariables)
+	if err != nil {
+		return err
+	}
+
+	if variables == nil {
+		// Variables are always checked, required ones are missing when none are given
+		variables = dfuse.GraphQLVariables{}
+	}
+
+	schema, err := validationSchema(cmd)
+	if err != nil {
+		return err
+	}
+
+	zlog.Info("validating graphql document", zap.String("file", filename), zap.String("operation", *flagValidateOperation))
+
+	err = schema.Validate(document, variables, *flagValidateOperation)
+
+	var validationErr *dfuse.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	for _, graphqlErr := range validationErr.Errors {
+		position := filename
+		if len(graphqlErr.Locations) > 0 {
+			position = fmt.Sprintf("%s:%d:%d", filename, graphqlErr.Locations[0].Line, graphqlErr.Locations[0].Column)
+		}
+
+		fmt.Printf("%s: %s\n", position, graphqlErr)
+	}
+
+	return fmt.Errorf("%d validation error(s) found", len(validationErr.Errors))
+}
+
+func validationSchema(cmd *cobra.Command) (*dfuse.GraphQLSchema, error) {
+	if *flagValidateSchema != "" {
+		content, err := ioutil.ReadFile(*flagValidateSchema)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema file: %w", err)
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+			return dfuse.NewGraphQLSchema(content)
+		}
+
+		return dfuse.NewGraphQLSchemaFromSDL(string(content))
+	}
+
+	config := &config{Endpoint: *flagValidateEndpoint}
+	config.resolveConnection(cmd)
+
+	client := newClient(config)
+	defer client.Close()
+
+	schema, err := client.GraphQLSchema(cmd.Context())
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve schema of endpoint: %w", err)
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,130 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ConnectivityObserver is called each time the client's gRPC connection transitions from
+// one state to another. It's invoked from a dedicated goroutine and must not block.
+type ConnectivityObserver func(from, to connectivity.State)
+
+// WithConnectivityObserver is an option to register a callback invoked on each state transition
+// of the client's gRPC connection, useful to reflect connectivity in readiness probes.
+func WithConnectivityObserver(observer ConnectivityObserver) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.connectivityObserver = observer })
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	conn, err := c.getGRPCConn()
+	if err != nil {
+		return fmt.Errorf("get grpc connection: %w", err)
+	}
+
+	conn.Connect()
+	return c.WaitReady(ctx)
+}
+
+func (c *client) WaitReady(ctx context.Context) error {
+	conn, err := c.getGRPCConn()
+	if err != nil {
+		return fmt.Errorf("get grpc connection: %w", err)
+	}
+
+	var lastErr error
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return errors.New("grpc connection is shut down")
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.TransientFailure:
+			if err := connectionError(ctx, conn); err != nil {
+				lastErr = err
+			}
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+
+			return fmt.Errorf("grpc connection not ready (state %s): %w", conn.GetState(), lastErr)
+		}
+	}
+}
+
+func (c *client) ConnectivityState() connectivity.State {
+	c.grpcLock.Lock()
+	conn := c.grpcConn
+	c.grpcLock.Unlock()
+
+	if conn == nil {
+		return connectivity.Idle
+	}
+
+	return conn.GetState()
+}
+
+// watchConnectivity notifies the connectivity observer, if any, of each state transition of
+// `conn` until the connection is shut down (the last transition reported) or, for a connection
+// received through `WithGRPCConn`, the client is closed.
+func (c *client) watchConnectivity(conn *grpc.ClientConn) {
+	if c.connectivityObserver == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopConnectivityWatch = cancel
+
+	from := conn.GetState()
+	go func() {
+		defer cancel()
+
+		for conn.WaitForStateChange(ctx, from) {
+			to := conn.GetState()
+			if tracer.Enabled() {
+				c.logger.Debug("grpc connection state changed", zap.Stringer("from", from), zap.Stringer("to", to))
+			}
+
+			c.connectivityObserver(from, to)
+			if to == connectivity.Shutdown {
+				return
+			}
+
+			from = to
+		}
+	}()
+}
+
+// connectionError returns the error that brought the connection in TRANSIENT_FAILURE. gRPC
+// reports it only through failing calls, so a fail-fast health check is issued, it fails
+// right away without reaching the server while the connection is in this state.
+//
+// The connection can leave this state between the check of its state and the call, the health
+// check then reaches the server (its outcome is ignored), the state is checked right before to
+// keep this window small. A dialer capturing dial errors is not used instead since TLS handshake
+// failures, the most common cause, happen after the dial.
+func connectionError(ctx context.Context, conn *grpc.ClientConn) error {
+	if conn.GetState() != connectivity.TransientFailure {
+		return nil
+	}
+
+	_, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(false))
+	if status.Code(err) == codes.Unavailable {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package dfuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+)
+
+// GraphQLTypedStream is a subscription stream decoding the data of each message, see
+// `Client.GraphQLTypedSubscription`.
+type GraphQLTypedStream interface {
+	// Recv receives the next message of the subscription and decodes its data into `out` (a
+	// pointer, like for `json.Unmarshal`). The error reports both the GraphQL errors sent with the
+	// message (as `GraphQLErrors`, see `GraphQLErrorPolicy`) and the failure to decode its data,
+	// if any, `out` receiving whatever could be decoded. `io.EOF` is returned as-is once the
+	// subscription completed.
+	Recv(out interface{}) error
+
+	// Stream returns the underlying stream.
+	Stream() GraphQLStream
+}
+
+func (c *client) GraphQLQueryInto(ctx context.Context, document string, out interface{}, opts ...GraphQLOption) error {
+	response, err := c.GraphQLQuery(ctx, document, withDefaultErrorPolicy(opts)...)
+	return decodeResponse(response, err, out)
+}
+
+func (c *client) GraphQLTypedSubscription(ctx context.Context, document string, opts ...GraphQLOption) (GraphQLTypedStream, error) {
+	stream, err := c.GraphQLSubscription(ctx, document, withDefaultErrorPolicy(opts)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &graphqlTypedStream{stream: stream}, nil
+}
+
+type graphqlTypedStream struct {
+	stream GraphQLStream
+}
+
+func (s *graphqlTypedStream) Recv(out interface{}) error {
+	response, err := s.stream.Recv()
+	return decodeResponse(response, err, out)
+}
+
+func (s *graphqlTypedStream) Stream() GraphQLStream {
+	return s.stream
+}
+
+// withDefaultErrorPolicy returns `opts` preceded by the `ErrorPolicyPartial` policy, the default
+// of decoding calls, so that a policy present in `opts` wins.
+func withDefaultErrorPolicy(opts []GraphQLOption) []GraphQLOption {
+	return append([]GraphQLOption{GraphQLErrorPolicy(ErrorPolicyPartial)}, opts...)
+}
+
+// decodeResponse decodes the data of `response`, if any, into `out`. Numbers decoded in an
+// `interface{}` are kept as `json.Number` so that large integers (like token amounts) don't lose
+// precision. The returned error reports both `responseErr` (the GraphQL errors surfaced by the
+// error policy) and the decoding error.
+func decodeResponse(response *pbgraphql.Response, responseErr error, out interface{}) error {
+	if response == nil || response.Data == "" {
+		return responseErr
+	}
+
+	decoder := json.NewDecoder(bytes.NewBufferString(response.Data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(out); err != nil {
+		if responseErr != nil {
+			return fmt.Errorf("%w (decode data: %s)", responseErr, err)
+		}
+
+		return fmt.Errorf("decode data: %w", err)
+	}
+
+	return responseErr
+}
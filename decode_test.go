@@ -0,0 +1,74 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlock struct {
+	Block struct {
+		Num    uint64      `json:"num"`
+		Amount interface{} `json:"amount"`
+	} `json:"block"`
+}
+
+func TestClient_GraphQLQueryInto(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       *pbgraphql.Response
+		expectedNum    uint64
+		expectedAmount interface{}
+		expectedErr    string
+	}{
+		{"decoded", &pbgraphql.Response{Data: `{"block":{"num":10,"amount":123456789012345678901234}}`}, 10, json.Number("123456789012345678901234"), ""},
+		{"no data", &pbgraphql.Response{}, 0, nil, ""},
+		{"graphql errors with partial data", &pbgraphql.Response{Data: `{"block":{"num":10}}`, Errors: []*pbgraphql.Error{{Message: "a"}, {Message: "b"}}}, 10, nil, "graphql errors: a; b"},
+		{"invalid data", &pbgraphql.Response{Data: `{"block":{"num":"ten"}}`}, 0, nil, "decode data: json: cannot unmarshal string"},
+		{"invalid data and graphql errors", &pbgraphql.Response{Data: `{"block":[]}`, Errors: []*pbgraphql.Error{{Message: "a"}}}, 0, nil, "graphql errors: a (decode data: json: cannot unmarshal array"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(&testTransport{responses: []*pbgraphql.Response{test.response}}))
+			require.NoError(t, err)
+
+			var out testBlock
+			err = client.GraphQLQueryInto(context.Background(), "{ block { num amount } }", &out)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+			}
+
+			assert.Equal(t, test.expectedNum, out.Block.Num)
+			assert.Equal(t, test.expectedAmount, out.Block.Amount)
+		})
+	}
+}
+
+func TestClient_GraphQLTypedSubscription(t *testing.T) {
+	client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(&testTransport{responses: []*pbgraphql.Response{
+		{Data: `{"block":{"num":1}}`},
+		{Data: `{"block":{"num":2}}`, Errors: []*pbgraphql.Error{{Message: "partial"}}},
+	}}))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLTypedSubscription(context.Background(), "subscription { block { num } }")
+	require.NoError(t, err)
+
+	var out testBlock
+	require.NoError(t, stream.Recv(&out))
+	assert.Equal(t, uint64(1), out.Block.Num)
+
+	assert.EqualError(t, stream.Recv(&out), "graphql errors: partial")
+	assert.Equal(t, uint64(2), out.Block.Num)
+
+	assert.Equal(t, io.EOF, stream.Recv(&out))
+}
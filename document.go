@@ -0,0 +1,123 @@
+package dfuse
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"reflect"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+)
+
+// GraphQLDocument is a GraphQL document loaded on demand, see `Client.GraphQLQueryDocument` and
+// `Client.GraphQLSubscriptionDocument`.
+type GraphQLDocument interface {
+	Load(ctx context.Context) (string, error)
+}
+
+// GraphQLStringDocument is a GraphQL document held in memory.
+type GraphQLStringDocument string
+
+func (d GraphQLStringDocument) Load(ctx context.Context) (string, error) {
+	return string(d), nil
+}
+
+// GraphQLFileDocument is a GraphQL document read from the file at this path. Its `#import
+// "fragments.graphql"` directives are resolved relative to it, the imported fragments it
+// references being appended to it.
+type GraphQLFileDocument string
+
+func (d GraphQLFileDocument) Load(ctx context.Context) (string, error) {
+	return loadImportingDocument(string(d), ioutil.ReadFile, joinFilePath)
+}
+
+// GraphQLFSDocument is a GraphQL document read from the file at `Path` in `FS`, typically an
+// `embed.FS` holding documents embedded through `//go:embed`. Its `#import` directives are
+// resolved like for `GraphQLFileDocument`, within `FS`.
+type GraphQLFSDocument struct {
+	FS   fs.FS
+	Path string
+}
+
+func (d GraphQLFSDocument) Load(ctx context.Context) (string, error) {
+	return loadImportingDocument(d.Path, func(filename string) ([]byte, error) { return fs.ReadFile(d.FS, filename) }, joinFSPath)
+}
+
+func (c *client) GraphQLQueryDocument(ctx context.Context, document GraphQLDocument, opts ...GraphQLOption) (*pbgraphql.Response, error) {
+	content, err := c.loadDocument(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GraphQLQuery(ctx, content, opts...)
+}
+
+func (c *client) GraphQLSubscriptionDocument(ctx context.Context, document GraphQLDocument, opts ...GraphQLOption) (GraphQLStream, error) {
+	content, err := c.loadDocument(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GraphQLSubscription(ctx, content, opts...)
+}
+
+// loadDocument loads `document`, caching its content for the lifetime of the client so that
+// file documents are read once. Documents are cached by value, those of a type which is not
+// comparable (like a `GraphQLFSDocument` over an `fstest.MapFS`) are loaded on each call.
+func (c *client) loadDocument(ctx context.Context, document GraphQLDocument) (string, error) {
+	if inMemory, ok := document.(GraphQLStringDocument); ok {
+		return string(inMemory), nil
+	}
+
+	cacheable := isComparable(document)
+	if cacheable {
+		if content, found := c.documentCache.Load(document); found {
+			return content.(string), nil
+		}
+	}
+
+	content, err := document.Load(ctx)
+	if err != nil {
+		return "", fmt.Errorf("load graphql document: %w", err)
+	}
+
+	if cacheable {
+		c.documentCache.Store(document, content)
+	}
+
+	return content, nil
+}
+
+// isComparable returns whether `value` can be used as a map key without panicking, its dynamic
+// type and all the dynamic types of its interface fields must be comparable.
+func isComparable(value interface{}) bool {
+	return isComparableValue(reflect.ValueOf(value))
+}
+
+func isComparableValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Interface:
+		return value.IsNil() || isComparableValue(value.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if !isComparableValue(value.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if !isComparableValue(value.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return value.Type().Comparable()
+	}
+}
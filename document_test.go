@@ -0,0 +1,64 @@
+package dfuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GraphQLQueryDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "query.graphql"), []byte(content), 0644))
+	}
+
+	mapFS := fstest.MapFS{"query.graphql": &fstest.MapFile{Data: []byte("{ v1 }")}}
+
+	tests := []struct {
+		name           string
+		document       GraphQLDocument
+		update         func()
+		expectedFirst  string
+		expectedSecond string
+		expectedErr    string
+	}{
+		{"string", GraphQLStringDocument("{ v1 }"), func() {}, "{ v1 }", "{ v1 }", ""},
+		{"file cached", GraphQLFileDocument(filepath.Join(dir, "query.graphql")), func() { writeFile("{ v2 }") }, "{ v1 }", "{ v1 }", ""},
+		{"fs cached", GraphQLFSDocument{FS: os.DirFS(dir), Path: "query.graphql"}, func() { writeFile("{ v2 }") }, "{ v1 }", "{ v1 }", ""},
+		{"non comparable fs not cached", GraphQLFSDocument{FS: mapFS, Path: "query.graphql"}, func() { mapFS["query.graphql"].Data = []byte("{ v2 }") }, "{ v1 }", "{ v2 }", ""},
+		{"missing file", GraphQLFileDocument(filepath.Join(dir, "missing.graphql")), func() {}, "", "", "load graphql document: open "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeFile("{ v1 }")
+
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQueryDocument(context.Background(), test.document)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedFirst, transport.request.Query)
+
+			test.update()
+
+			_, err = client.GraphQLSubscriptionDocument(context.Background(), test.document)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedSecond, transport.request.Query)
+		})
+	}
+}
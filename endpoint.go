@@ -0,0 +1,152 @@
+package dfuse
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Transport determines how the gRPC connection to an endpoint is secured.
+type Transport int
+
+const (
+	// TransportUnspecified is used for bare `host[:port]` endpoints, the actual transport is
+	// then determined by `WithPlainText`/`WithInsecure` options, defaulting to TLS.
+	TransportUnspecified Transport = iota
+	TransportPlainText
+	TransportInsecureTLS
+	TransportTLS
+)
+
+func (t Transport) String() string {
+	switch t {
+	case TransportUnspecified:
+		return "unspecified"
+	case TransportPlainText:
+		return "plain-text"
+	case TransportInsecureTLS:
+		return "insecure-tls"
+	case TransportTLS:
+		return "tls"
+	default:
+		return "unknown(" + strconv.FormatInt(int64(t), 10) + ")"
+	}
+}
+
+// Endpoint is the parsed representation of the `network` argument received by `NewClient`.
+//
+// The following forms are accepted:
+//
+//	mainnet.eos.dfuse.io[:443]         (bare, transport and port inferred from options)
+//	*localhost[:8443]                  (bare, TLS without certificate validation)
+//	grpc://localhost[:9000]            (plain-text, no TLS)
+//	grpcs://mainnet.eos.dfuse.io[:443] (TLS)
+//	grpcs+insecure://localhost[:443]   (TLS without certificate validation)
+//	unix:///var/run/dfuse.sock         (plain-text over a Unix domain socket)
+//
+// A `*` in a bare endpoint is stripped and marks it as insecure TLS. Bare endpoints whose host is
+// `localhost` default to plain-text when no option selects the transport, see `DefaultTransport`.
+type Endpoint struct {
+	// Scheme is the scheme the endpoint was defined with, empty for bare endpoints.
+	Scheme string
+
+	// Target is the gRPC dial target, `host[:port]` for network endpoints and
+	// `unix:///path` for Unix domain sockets.
+	Target string
+
+	// Transport is the transport implied by the scheme (or the `*` marker), `TransportUnspecified`
+	// when the endpoint was bare.
+	Transport Transport
+}
+
+func (e *Endpoint) String() string {
+	if e.Scheme == "" || e.Scheme == "unix" {
+		return e.Target
+	}
+
+	return e.Scheme + "://" + e.Target
+}
+
+// HasPort returns `true` if the endpoint target specifies a port explicitly. Unix domain
+// socket endpoints are always considered to have a port since none needs to be inferred.
+func (e *Endpoint) HasPort() bool {
+	if e.Scheme == "unix" {
+		return true
+	}
+
+	_, port, err := net.SplitHostPort(e.Target)
+	return err == nil && port != ""
+}
+
+// DefaultTransport returns the transport of the endpoint when no option selects one: the one
+// implied by its scheme, plain-text for bare `localhost` endpoints and TLS otherwise.
+func (e *Endpoint) DefaultTransport() Transport {
+	if e.Transport != TransportUnspecified {
+		return e.Transport
+	}
+
+	host := e.Target
+	if withoutPort, _, err := net.SplitHostPort(e.Target); err == nil {
+		host = withoutPort
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return TransportPlainText
+	}
+
+	return TransportTLS
+}
+
+var endpointSchemes = map[string]Transport{
+	"grpc":           TransportPlainText,
+	"grpcs":          TransportTLS,
+	"grpcs+insecure": TransportInsecureTLS,
+	"unix":           TransportPlainText,
+}
+
+// ParseEndpoint parses the received endpoint definition, see `Endpoint` for the list of
+// accepted forms.
+func ParseEndpoint(in string) (*Endpoint, error) {
+	if in == "" {
+		return nil, fmt.Errorf("endpoint is empty")
+	}
+
+	if !strings.Contains(in, "://") {
+		if strings.Contains(in, "*") {
+			return &Endpoint{Target: strings.ReplaceAll(in, "*", ""), Transport: TransportInsecureTLS}, nil
+		}
+
+		return &Endpoint{Target: in, Transport: TransportUnspecified}, nil
+	}
+
+	parsed, err := url.Parse(in)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", in, err)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	transport, found := endpointSchemes[scheme]
+	if !found {
+		return nil, fmt.Errorf("invalid endpoint %q: unknown scheme %q, accepted schemes are grpc, grpcs, grpcs+insecure and unix", in, parsed.Scheme)
+	}
+
+	if scheme == "unix" {
+		if parsed.Host != "" || parsed.Path == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: expected an absolute socket path like unix:///path/to/file.sock", in)
+		}
+
+		return &Endpoint{Scheme: scheme, Target: "unix://" + parsed.Path, Transport: transport}, nil
+	}
+
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: host is empty", in)
+	}
+
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: only a host and an optional port are accepted", in)
+	}
+
+	return &Endpoint{Scheme: scheme, Target: parsed.Host, Transport: transport}, nil
+}
@@ -0,0 +1,128 @@
+package dfuse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		expected    *Endpoint
+		expectedErr string
+	}{
+		{"bare host", "mainnet.eos.dfuse.io", &Endpoint{"", "mainnet.eos.dfuse.io", TransportUnspecified}, ""},
+		{"bare host and port", "localhost:9000", &Endpoint{"", "localhost:9000", TransportUnspecified}, ""},
+		{"bare insecure", "*localhost:8443", &Endpoint{"", "localhost:8443", TransportInsecureTLS}, ""},
+		{"grpc", "grpc://localhost:9000", &Endpoint{"grpc", "localhost:9000", TransportPlainText}, ""},
+		{"grpc no port", "grpc://localhost", &Endpoint{"grpc", "localhost", TransportPlainText}, ""},
+		{"grpcs", "grpcs://mainnet.eos.dfuse.io", &Endpoint{"grpcs", "mainnet.eos.dfuse.io", TransportTLS}, ""},
+		{"grpcs trailing slash", "grpcs://mainnet.eos.dfuse.io:443/", &Endpoint{"grpcs", "mainnet.eos.dfuse.io:443", TransportTLS}, ""},
+		{"grpcs+insecure", "grpcs+insecure://localhost:8443", &Endpoint{"grpcs+insecure", "localhost:8443", TransportInsecureTLS}, ""},
+		{"unix", "unix:///var/run/dfuse.sock", &Endpoint{"unix", "unix:///var/run/dfuse.sock", TransportPlainText}, ""},
+
+		{"empty", "", nil, "endpoint is empty"},
+		{"unknown scheme", "http://localhost", nil, `invalid endpoint "http://localhost": unknown scheme "http", accepted schemes are grpc, grpcs, grpcs+insecure and unix`},
+		{"no host", "grpcs://", nil, `invalid endpoint "grpcs://": host is empty`},
+		{"with path", "grpcs://localhost/graphql", nil, `invalid endpoint "grpcs://localhost/graphql": only a host and an optional port are accepted`},
+		{"unix with host", "unix://var/run/dfuse.sock", nil, `invalid endpoint "unix://var/run/dfuse.sock": expected an absolute socket path like unix:///path/to/file.sock`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseEndpoint(test.in)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, actual)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewClient_Endpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		network      string
+		opts         []ClientOption
+		expectedAddr string
+		expectedErr  string
+	}{
+		{"bare defaults to tls port", "mainnet.eos.dfuse.io", nil, "mainnet.eos.dfuse.io:443", ""},
+		{"bare plain-text port", "localhost", []ClientOption{WithPlainText()}, "localhost:9000", ""},
+		{"bare localhost defaults to plain-text", "localhost", nil, "localhost:9000", ""},
+		{"bare localhost with insecure option", "localhost", []ClientOption{WithInsecure()}, "localhost:443", ""},
+		{"bare insecure marker", "*localhost", nil, "localhost:443", ""},
+		{"bare explicit port", "localhost", []ClientOption{WithGRPCPort(13023)}, "localhost:13023", ""},
+		{"grpc infers plain-text port", "grpc://localhost", nil, "localhost:9000", ""},
+		{"grpcs infers tls port", "grpcs://mainnet.eos.dfuse.io", nil, "mainnet.eos.dfuse.io:443", ""},
+		{"grpcs explicit port", "grpcs://mainnet.eos.dfuse.io:8443", nil, "mainnet.eos.dfuse.io:8443", ""},
+		{"grpc single digit port", "grpc://127.0.0.1:1", nil, "127.0.0.1:1", ""},
+		{"unix", "unix:///tmp/dfuse.sock", nil, "unix:///tmp/dfuse.sock", ""},
+		{"grpc with same option", "grpc://localhost", []ClientOption{WithPlainText()}, "localhost:9000", ""},
+
+		{"grpcs conflicting option", "grpcs://localhost", []ClientOption{WithPlainText()}, "", `endpoint "grpcs://localhost" implies tls transport which conflicts with plain-text transport requested through options`},
+		{"insecure marker conflicting option", "*localhost", []ClientOption{WithPlainText()}, "", `endpoint "localhost" implies insecure-tls transport which conflicts with plain-text transport requested through options`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]ClientOption{WithoutAuthentication(), WithAPITokenStore(NewInMemoryAPITokenStore())}, test.opts...)
+
+			actual, err := NewClient(test.network, "", opts...)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedAddr, actual.(*client).grpcAddr)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestEndpoint_HasPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		expected bool
+	}{
+		{"bare host", &Endpoint{"", "mainnet.eos.dfuse.io", TransportUnspecified}, false},
+		{"single digit port", &Endpoint{"grpc", "127.0.0.1:1", TransportPlainText}, true},
+		{"two digits port", &Endpoint{"grpc", "localhost:90", TransportPlainText}, true},
+		{"five digits port", &Endpoint{"grpcs", "localhost:65535", TransportTLS}, true},
+		{"ipv6 with port", &Endpoint{"grpc", "[::1]:9", TransportPlainText}, true},
+		{"ipv6 without port", &Endpoint{"grpc", "::1", TransportPlainText}, false},
+		{"empty port", &Endpoint{"grpc", "localhost:", TransportPlainText}, false},
+		{"unix", &Endpoint{"unix", "unix:///var/run/dfuse.sock", TransportPlainText}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.endpoint.HasPort())
+		})
+	}
+}
+
+func TestEndpoint_DefaultTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		expected Transport
+	}{
+		{"bare host", &Endpoint{"", "mainnet.eos.dfuse.io", TransportUnspecified}, TransportTLS},
+		{"bare localhost", &Endpoint{"", "localhost", TransportUnspecified}, TransportPlainText},
+		{"bare localhost with port", &Endpoint{"", "localhost:9000", TransportUnspecified}, TransportPlainText},
+		{"bare localhost lookalike", &Endpoint{"", "mylocalhost.io:9000", TransportUnspecified}, TransportTLS},
+		{"scheme", &Endpoint{"grpcs", "localhost", TransportTLS}, TransportTLS},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.endpoint.DefaultTransport())
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package dfuse_test
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"os"
+
+	dfuse "github.com/streamingfast/client-go"
+)
+
+//go:embed example_graphql_query.graphql
+var exampleDocuments embed.FS
+
+func ExampleClient_GraphQLQueryDocument() {
+	client, err := dfuse.NewClient("eos-testnet", os.Getenv("DFUSE_API_KEY"))
+	if err != nil {
+		panic(fmt.Errorf("new dfuse client: %w", err))
+	}
+
+	document := dfuse.GraphQLFSDocument{FS: exampleDocuments, Path: "example_graphql_query.graphql"}
+	response, err := client.GraphQLQueryDocument(context.Background(), document, dfuse.GraphQLVariables{
+		"blockNum": 10,
+	})
+	if err != nil {
+		panic(fmt.Errorf("graphql query: %w", err))
+	}
+
+	fmt.Println(response.Data, response.Errors)
+}
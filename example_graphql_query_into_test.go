@@ -0,0 +1,36 @@
+package dfuse_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	dfuse "github.com/streamingfast/client-go"
+)
+
+func ExampleClient_GraphQLQueryInto() {
+	client, err := dfuse.NewClient("eos-testnet", os.Getenv("DFUSE_API_KEY"))
+	if err != nil {
+		panic(fmt.Errorf("new dfuse client: %w", err))
+	}
+
+	var out struct {
+		Block struct {
+			ID     string `json:"id"`
+			Num    uint32 `json:"num"`
+			Header struct {
+				Producer string `json:"producer"`
+			} `json:"header"`
+		} `json:"block"`
+	}
+
+	document := graphqlDocumentFromFile("example_graphql_query.graphql")
+	err = client.GraphQLQueryInto(context.Background(), document, &out, dfuse.GraphQLVariables{
+		"blockNum": 10,
+	})
+	if err != nil {
+		panic(fmt.Errorf("graphql query: %w", err))
+	}
+
+	fmt.Println(out.Block.ID, out.Block.Num, out.Block.Header.Producer)
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func ExampleClient_GraphQLSubscription() {
-	client, err := dfuse.NewClient("testnet.eos.dfuse.io", os.Getenv("DFUSE_API_KEY"))
+	client, err := dfuse.NewClient("eos-testnet", os.Getenv("DFUSE_API_KEY"))
 	if err != nil {
 		panic(fmt.Errorf("new dfuse client: %w", err))
 	}
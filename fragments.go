@@ -0,0 +1,313 @@
+package dfuse
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// FragmentRegistry is a library of named GraphQL fragments, the fragments referenced by a
+// document (directly or through other fragments) and not defined by it are appended to it
+// by `Resolve`, see `WithFragmentRegistry`.
+type FragmentRegistry struct {
+	lock      sync.RWMutex
+	fragments map[string]*ast.FragmentDefinition
+}
+
+func NewFragmentRegistry() *FragmentRegistry {
+	return &FragmentRegistry{fragments: map[string]*ast.FragmentDefinition{}}
+}
+
+// WithFragmentRegistry is an option to resolve the fragments of all documents sent by the client
+// against `registry`, see `FragmentRegistry.Resolve`. Documents referencing unknown fragments or
+// defining unused ones fail before being sent, with or without a registry.
+func WithFragmentRegistry(registry *FragmentRegistry) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.fragmentRegistry = registry })
+}
+
+// Register adds the fragments defined in `source`, which must contain only fragment definitions.
+// Registering a fragment whose name is already registered is an error.
+func (r *FragmentRegistry) Register(source string) error {
+	return r.register("", source)
+}
+
+// RegisterFile adds the fragments defined in the file at `filename`, see `Register`.
+func (r *FragmentRegistry) RegisterFile(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("read fragments file: %w", err)
+	}
+
+	return r.register(filename, string(content))
+}
+
+// RegisterFS adds the fragments defined in the files of `fsys` matching `pattern` (see
+// `fs.Glob`), like an `embed.FS` holding `.graphql` files, see `Register`.
+func (r *FragmentRegistry) RegisterFS(fsys fs.FS, pattern string) error {
+	filenames, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	for _, filename := range filenames {
+		content, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return fmt.Errorf("read fragments file: %w", err)
+		}
+
+		if err := r.register(filename, string(content)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *FragmentRegistry) register(filename string, source string) error {
+	fragments, err := parseFragments(filename, source)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, fragment := range fragments {
+		if _, found := r.fragments[fragment.Name]; found {
+			return fmt.Errorf("fragment %q already registered", fragment.Name)
+		}
+	}
+
+	for _, fragment := range fragments {
+		r.fragments[fragment.Name] = fragment
+	}
+
+	return nil
+}
+
+// Names returns the names of the registered fragments, sorted.
+func (r *FragmentRegistry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := make([]string, 0, len(r.fragments))
+	for name := range r.fragments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns `document` with the registered fragments it references (directly or through
+// other fragments) appended, only those not defined by the document itself. Fragments referenced
+// but neither defined by the document nor registered, as well as fragments defined by the
+// document but never used, are reported as an error.
+func (r *FragmentRegistry) Resolve(document string) (string, error) {
+	parsed, err := parseDocument(document)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, _, err := r.resolve(document, parsed)
+	return resolved, err
+}
+
+// resolve is `Resolve` for `document` already parsed as `parsed`, also returning the resolved
+// document parsed, sharing the registered fragments appended to it.
+func (r *FragmentRegistry) resolve(document string, parsed *ast.QueryDocument) (string, *ast.QueryDocument, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return resolveFragments(document, parsed, r.fragments, false)
+}
+
+// parseFragments parses `source` which must contain only fragment definitions.
+func parseFragments(filename string, source string) ([]*ast.FragmentDefinition, error) {
+	parsed, err := parser.ParseQuery(&ast.Source{Name: filename, Input: source})
+	if err != nil {
+		return nil, fmt.Errorf("parse fragments: %w", err)
+	}
+
+	if len(parsed.Operations) > 0 {
+		return nil, fmt.Errorf("parse fragments %s: only fragment definitions are allowed, found an operation", filename)
+	}
+
+	return parsed.Fragments, nil
+}
+
+// resolveFragments appends to `document`, parsed as `parsed`, the fragments of `available` it
+// references and does not define, see `FragmentRegistry.Resolve`. The resolved document is
+// returned along its parsed form, `parsed` itself when no fragment was appended. When
+// `allowUnknown` is set, references to fragments defined nowhere are left as-is instead of being
+// reported.
+func resolveFragments(document string, parsed *ast.QueryDocument, available map[string]*ast.FragmentDefinition, allowUnknown bool) (string, *ast.QueryDocument, error) {
+	local := map[string]*ast.FragmentDefinition{}
+	for _, fragment := range parsed.Fragments {
+		local[fragment.Name] = fragment
+	}
+
+	used := map[string]bool{}
+	var appended []*ast.FragmentDefinition
+	var unknown []string
+
+	for _, operation := range parsed.Operations {
+		visitFragmentSpreads(operation.SelectionSet, used, func(name string) *ast.FragmentDefinition {
+			if fragment, found := local[name]; found {
+				return fragment
+			}
+
+			if fragment, found := available[name]; found {
+				appended = append(appended, fragment)
+				return fragment
+			}
+
+			unknown = append(unknown, name)
+			return nil
+		})
+	}
+
+	var unused []string
+	if len(parsed.Operations) > 0 {
+		for _, fragment := range parsed.Fragments {
+			if !used[fragment.Name] {
+				unused = append(unused, fragment.Name)
+			}
+		}
+	}
+
+	if len(unknown) > 0 && !allowUnknown {
+		return "", nil, fmt.Errorf("unknown fragment(s) %s", strings.Join(unknown, ", "))
+	}
+
+	if len(unused) > 0 {
+		return "", nil, fmt.Errorf("unused fragment(s) %s", strings.Join(unused, ", "))
+	}
+
+	if len(appended) == 0 {
+		return document, parsed, nil
+	}
+
+	buffer := bytes.NewBufferString(strings.TrimRight(document, "\n"))
+	buffer.WriteString("\n\n")
+	formatter.NewFormatter(buffer, formatter.WithIndent("  ")).FormatQueryDocument(&ast.QueryDocument{Fragments: appended})
+
+	resolved := &ast.QueryDocument{Operations: parsed.Operations, Fragments: append(append(ast.FragmentDefinitionList(nil), parsed.Fragments...), appended...), Position: parsed.Position}
+
+	return buffer.String(), resolved, nil
+}
+
+// visitFragmentSpreads calls `visit` once for each fragment spread name found in `selections`
+// and, transitively, in the selections of the fragments it returns (`nil` when unknown). Names
+// present in `visited` are skipped, visited names are added to it.
+func visitFragmentSpreads(selections ast.SelectionSet, visited map[string]bool, visit func(name string) *ast.FragmentDefinition) {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			visitFragmentSpreads(selection.SelectionSet, visited, visit)
+		case *ast.InlineFragment:
+			visitFragmentSpreads(selection.SelectionSet, visited, visit)
+		case *ast.FragmentSpread:
+			if visited[selection.Name] {
+				continue
+			}
+
+			visited[selection.Name] = true
+			if fragment := visit(selection.Name); fragment != nil {
+				visitFragmentSpreads(fragment.SelectionSet, visited, visit)
+			}
+		}
+	}
+}
+
+// importDirectiveRegex matches `#import "fragments.graphql"` lines, GraphQL comments pointing
+// to files (relative to the importing one) holding fragment definitions.
+var importDirectiveRegex = regexp.MustCompile(`(?m)^[ \t]*#import[ \t]+"([^"]+)"[ \t]*$`)
+
+// loadImportingDocument reads the document `filename` through `readFile` and resolves its
+// `#import` directives, recursively, appending the imported fragments it references. Fragments
+// defined nowhere are left as-is, a client's `FragmentRegistry` might define them.
+func loadImportingDocument(filename string, readFile func(filename string) ([]byte, error), join func(from, imported string) string) (string, error) {
+	content, err := readFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	document := string(content)
+	if !importDirectiveRegex.MatchString(document) {
+		return document, nil
+	}
+
+	available := map[string]*ast.FragmentDefinition{}
+	visited := map[string]bool{filename: true}
+
+	var collect func(from string, source string) error
+	collect = func(from string, source string) error {
+		for _, match := range importDirectiveRegex.FindAllStringSubmatch(source, -1) {
+			imported := join(from, match[1])
+			if visited[imported] {
+				continue
+			}
+
+			visited[imported] = true
+			content, err := readFile(imported)
+			if err != nil {
+				return fmt.Errorf("import %q from %s: %w", match[1], from, err)
+			}
+
+			fragments, err := parseFragments(imported, string(content))
+			if err != nil {
+				return err
+			}
+
+			for _, fragment := range fragments {
+				if _, found := available[fragment.Name]; found {
+					return fmt.Errorf("fragment %q imported more than once", fragment.Name)
+				}
+
+				available[fragment.Name] = fragment
+			}
+
+			if err := collect(imported, string(content)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := collect(filename, document); err != nil {
+		return "", err
+	}
+
+	parsed, err := parseDocument(document)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, _, err := resolveFragments(document, parsed, available, true)
+	return resolved, err
+}
+
+func joinFilePath(from, imported string) string {
+	if filepath.IsAbs(imported) {
+		return imported
+	}
+
+	return filepath.Join(filepath.Dir(from), imported)
+}
+
+func joinFSPath(from, imported string) string {
+	return path.Join(path.Dir(from), imported)
+}
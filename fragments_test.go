@@ -0,0 +1,182 @@
+package dfuse
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFragmentRegistry_Resolve(t *testing.T) {
+	registry := NewFragmentRegistry()
+	require.NoError(t, registry.Register(`
+fragment Transfer on Action { from to amount ...Account }
+fragment Account on Action { account }
+fragment Unused on Action { name }
+`))
+
+	tests := []struct {
+		name        string
+		document    string
+		expected    string
+		expectedErr string
+	}{
+		{"no fragments", "{ block { number } }", "{ block { number } }", ""},
+		{"local fragment", "{ block { ...Local } }\nfragment Local on Block { number }", "{ block { ...Local } }\nfragment Local on Block { number }", ""},
+		{"registered fragment", "{ actions { ...Account } }\n", "{ actions { ...Account } }\n\nfragment Account on Action {\n  account\n}\n", ""},
+		{
+			"transitive fragments",
+			"{ actions { ... on Action { ...Transfer } } }",
+			"{ actions { ... on Action { ...Transfer } } }\n\nfragment Transfer on Action {\n  from\n  to\n  amount\n  ... Account\n}\nfragment Account on Action {\n  account\n}\n",
+			"",
+		},
+		{"local overrides registered", "{ actions { ...Account } }\nfragment Account on Action { name }", "{ actions { ...Account } }\nfragment Account on Action { name }", ""},
+		{"unknown fragment", "{ actions { ...Missing ...Other } }", "", "unknown fragment(s) Missing, Other"},
+		{"unused local fragment", "{ actions { name } }\nfragment Local on Action { name }", "", "unused fragment(s) Local"},
+		{"invalid document", "{ actions {", "", "parse graphql document: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := registry.Resolve(test.document)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, resolved)
+		})
+	}
+}
+
+func TestFragmentRegistry_Register(t *testing.T) {
+	tests := []struct {
+		name        string
+		sources     []string
+		expected    []string
+		expectedErr string
+	}{
+		{"single", []string{"fragment A on T { a }"}, []string{"A"}, ""},
+		{"multiple sources", []string{"fragment B on T { b }", "fragment A on T { a }"}, []string{"A", "B"}, ""},
+		{"duplicate", []string{"fragment A on T { a }", "fragment A on T { b }"}, []string{"A"}, `fragment "A" already registered`},
+		{"operation", []string{"{ a }"}, []string{}, "only fragment definitions are allowed"},
+		{"invalid", []string{"fragment A on"}, []string{}, "parse fragments: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewFragmentRegistry()
+
+			var err error
+			for _, source := range test.sources {
+				if err = registry.Register(source); err != nil {
+					break
+				}
+			}
+
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, test.expected, registry.Names())
+		})
+	}
+}
+
+func TestGraphQLFSDocument_Imports(t *testing.T) {
+	fsys := fstest.MapFS{
+		"queries/transfers.graphql":  {Data: []byte("#import \"../fragments/transfer.graphql\"\n{ actions { ...Transfer } }\n")},
+		"queries/cycle.graphql":      {Data: []byte("#import \"../fragments/cycle.graphql\"\n{ actions { ...Cycle } }\n")},
+		"queries/registry.graphql":   {Data: []byte("#import \"../fragments/account.graphql\"\n{ actions { ...Account ...Registered } }\n")},
+		"queries/missing.graphql":    {Data: []byte("#import \"absent.graphql\"\n{ actions { name } }\n")},
+		"queries/operation.graphql":  {Data: []byte("#import \"transfers.graphql\"\n{ actions { name } }\n")},
+		"queries/unused.graphql":     {Data: []byte("#import \"../fragments/account.graphql\"\n{ actions { name } }\nfragment Local on Action { name }\n")},
+		"fragments/transfer.graphql": {Data: []byte("#import \"account.graphql\"\nfragment Transfer on Action { from ...Account }\nfragment Extra on Action { name }\n")},
+		"fragments/account.graphql":  {Data: []byte("fragment Account on Action { account }\n")},
+		"fragments/cycle.graphql":    {Data: []byte("#import \"cycle.graphql\"\nfragment Cycle on Action { name }\n")},
+	}
+
+	registry := NewFragmentRegistry()
+	require.NoError(t, registry.Register("fragment Registered on Action { registered }"))
+
+	tests := []struct {
+		name        string
+		path        string
+		expected    string
+		expectedErr string
+	}{
+		{
+			"nested imports",
+			"queries/transfers.graphql",
+			"#import \"../fragments/transfer.graphql\"\n{ actions { ...Transfer } }\n\nfragment Transfer on Action {\n  from\n  ... Account\n}\nfragment Account on Action {\n  account\n}\n",
+			"",
+		},
+		{"import cycle", "queries/cycle.graphql", "#import \"../fragments/cycle.graphql\"\n{ actions { ...Cycle } }\n\nfragment Cycle on Action {\n  name\n}\n", ""},
+		{
+			"imported and registered",
+			"queries/registry.graphql",
+			"#import \"../fragments/account.graphql\"\n{ actions { ...Account ...Registered } }\n\nfragment Account on Action {\n  account\n}\n\nfragment Registered on Action {\n  registered\n}\n",
+			"",
+		},
+		{"missing import", "queries/missing.graphql", "", `import "absent.graphql" from queries/missing.graphql: open queries/absent.graphql`},
+		{"import with operation", "queries/operation.graphql", "", "only fragment definitions are allowed"},
+		{"unused local fragment", "queries/unused.graphql", "", "unused fragment(s) Local"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithFragmentRegistry(registry))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQueryDocument(context.Background(), GraphQLFSDocument{FS: fsys, Path: test.path})
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, transport.request.Query)
+		})
+	}
+}
+
+func TestClient_FragmentsWithoutRegistry(t *testing.T) {
+	tests := []struct {
+		name        string
+		document    string
+		expectedErr string
+	}{
+		{"local fragment", "{ actions { ...Local } }\nfragment Local on Action { name }", ""},
+		{"unknown fragment", "{ actions { ...Missing } }", "unknown fragment(s) Missing"},
+		{"unused local fragment", "{ actions { name } }\nfragment Local on Action { name }", "unused fragment(s) Local"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(context.Background(), test.document)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				assert.Nil(t, transport.request, "the document must not be sent")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.document, transport.request.Query)
+		})
+	}
+}
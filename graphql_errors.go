@@ -0,0 +1,136 @@
+package dfuse
+
+import (
+	"fmt"
+	"strings"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+)
+
+// GraphQLError is an error reported by the server in the `errors` field of a GraphQL response.
+type GraphQLError struct {
+	// Message describes the error, it's intended for the developer.
+	Message string
+
+	// Locations are the positions in the document the error relates to, if any.
+	Locations []GraphQLErrorLocation
+
+	// Path is the path of the response field that failed, made of field names (`string`) and
+	// list indices (`float64`), if any.
+	Path []interface{}
+
+	// Extensions holds the free-form details attached by the server (like an error code), if any.
+	Extensions map[string]interface{}
+}
+
+// GraphQLErrorLocation is a position in a GraphQL document, 1-based.
+type GraphQLErrorLocation struct {
+	Line   int
+	Column int
+}
+
+func (e *GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+
+	path := make([]string, len(e.Path))
+	for i, element := range e.Path {
+		path[i] = fmt.Sprint(element)
+	}
+
+	return fmt.Sprintf("%s (at %s)", e.Message, strings.Join(path, "."))
+}
+
+// GraphQLErrors are the errors of a GraphQL response, returned as an error according to the
+// policy selected through `GraphQLErrorPolicy`. Use `errors.As` to retrieve them.
+type GraphQLErrors []*GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, graphqlErr := range e {
+		messages[i] = graphqlErr.Error()
+	}
+
+	return "graphql errors: " + strings.Join(messages, "; ")
+}
+
+func newGraphQLErrors(errs []*pbgraphql.Error) GraphQLErrors {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	out := make(GraphQLErrors, len(errs))
+	for i, graphqlErr := range errs {
+		converted := &GraphQLError{Message: graphqlErr.Message}
+		for _, location := range graphqlErr.Locations {
+			converted.Locations = append(converted.Locations, GraphQLErrorLocation{Line: int(location.Line), Column: int(location.Column)})
+		}
+
+		if graphqlErr.Path != nil {
+			converted.Path = graphqlErr.Path.AsSlice()
+		}
+
+		if graphqlErr.Extensions != nil {
+			converted.Extensions = graphqlErr.Extensions.AsMap()
+		}
+
+		out[i] = converted
+	}
+
+	return out
+}
+
+// ErrorPolicy defines how the errors present in a GraphQL response are surfaced, see
+// `GraphQLErrorPolicy`.
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyIgnore returns the response with a `nil` error, errors are only available in the
+	// response's `Errors` field. It's the default of `GraphQLQuery` and `GraphQLSubscription`.
+	ErrorPolicyIgnore ErrorPolicy = iota + 1
+
+	// ErrorPolicyPartial returns the response, with whatever partial data it carries, along a
+	// `GraphQLErrors` error. It's the default of `GraphQLQueryInto` and `GraphQLTypedSubscription`.
+	ErrorPolicyPartial
+
+	// ErrorPolicyFail returns a `nil` response along a `GraphQLErrors` error, partial data is
+	// discarded.
+	ErrorPolicyFail
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyIgnore:
+		return "ignore"
+	case ErrorPolicyPartial:
+		return "partial"
+	case ErrorPolicyFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// GraphQLErrorPolicy option to select how errors present in GraphQL responses are surfaced, for
+// subscriptions the policy is applied to each message received, the stream continuing after a
+// message with errors.
+func GraphQLErrorPolicy(policy ErrorPolicy) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) { o.errorPolicy = policy })
+}
+
+// apply returns the response and the error to surface for `response` according to the policy.
+func (p ErrorPolicy) apply(response *pbgraphql.Response) (*pbgraphql.Response, error) {
+	if len(response.Errors) == 0 {
+		return response, nil
+	}
+
+	switch p {
+	case ErrorPolicyPartial:
+		return response, newGraphQLErrors(response.Errors)
+	case ErrorPolicyFail:
+		return nil, newGraphQLErrors(response.Errors)
+	default:
+		return response, nil
+	}
+}
@@ -0,0 +1,93 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestClient_GraphQLErrorPolicy(t *testing.T) {
+	path, err := structpb.NewList([]interface{}{"block", 0, "num"})
+	require.NoError(t, err)
+
+	extensions, err := structpb.NewStruct(map[string]interface{}{"code": "NOT_FOUND"})
+	require.NoError(t, err)
+
+	withErrors := &pbgraphql.Response{Data: `{"block":null}`, Errors: []*pbgraphql.Error{
+		{Message: "block not found", Locations: []*pbgraphql.SourceLocation{{Line: 1, Column: 3}}, Path: path, Extensions: extensions},
+	}}
+
+	expectedErrors := GraphQLErrors{{
+		Message:    "block not found",
+		Locations:  []GraphQLErrorLocation{{Line: 1, Column: 3}},
+		Path:       []interface{}{"block", float64(0), "num"},
+		Extensions: map[string]interface{}{"code": "NOT_FOUND"},
+	}}
+
+	tests := []struct {
+		name             string
+		response         *pbgraphql.Response
+		opts             []GraphQLOption
+		expectedResponse bool
+		expectedErrors   GraphQLErrors
+	}{
+		{"default ignores", withErrors, nil, true, nil},
+		{"ignore", withErrors, []GraphQLOption{GraphQLErrorPolicy(ErrorPolicyIgnore)}, true, nil},
+		{"partial", withErrors, []GraphQLOption{GraphQLErrorPolicy(ErrorPolicyPartial)}, true, expectedErrors},
+		{"fail", withErrors, []GraphQLOption{GraphQLErrorPolicy(ErrorPolicyFail)}, false, expectedErrors},
+		{"fail without errors", &pbgraphql.Response{Data: `{}`}, []GraphQLOption{GraphQLErrorPolicy(ErrorPolicyFail)}, true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(&testTransport{responses: []*pbgraphql.Response{test.response}}))
+			require.NoError(t, err)
+
+			response, err := client.GraphQLQuery(context.Background(), "{ block { num } }", test.opts...)
+			assert.Equal(t, test.expectedResponse, response != nil)
+
+			if test.expectedErrors == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var graphqlErrs GraphQLErrors
+			require.True(t, errors.As(err, &graphqlErrs))
+			assert.Equal(t, test.expectedErrors, graphqlErrs)
+			assert.EqualError(t, err, "graphql errors: block not found (at block.0.num)")
+		})
+	}
+}
+
+func TestClient_GraphQLErrorPolicy_Subscription(t *testing.T) {
+	client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(&testTransport{responses: []*pbgraphql.Response{
+		{Data: `{"a":1}`},
+		{Errors: []*pbgraphql.Error{{Message: "boom"}}},
+		{Data: `{"a":2}`},
+	}}))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLSubscription(context.Background(), "subscription { a }", GraphQLErrorPolicy(ErrorPolicyFail))
+	require.NoError(t, err)
+
+	response, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, response.Data)
+
+	response, err = stream.Recv()
+	assert.Nil(t, response)
+	assert.EqualError(t, err, "graphql errors: boom")
+
+	response, err = stream.Recv()
+	require.NoError(t, err, "stream continues after a message with errors")
+	assert.Equal(t, `{"a":2}`, response.Data)
+
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
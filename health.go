@@ -0,0 +1,55 @@
+package dfuse
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GraphQLHealthService is the service name to use with `Client.HealthCheck` to check the health
+// of the GraphQL over gRPC service specifically, an empty service name checks the server as a whole.
+const GraphQLHealthService = "sf.graphql.v1.GraphQL"
+
+// HealthStatus is the serving status reported by the endpoint's `grpc.health.v1.Health` service.
+type HealthStatus = grpc_health_v1.HealthCheckResponse_ServingStatus
+
+const (
+	HealthStatusUnknown        = grpc_health_v1.HealthCheckResponse_UNKNOWN
+	HealthStatusServing        = grpc_health_v1.HealthCheckResponse_SERVING
+	HealthStatusNotServing     = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	HealthStatusServiceUnknown = grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN
+)
+
+func (c *client) HealthCheck(ctx context.Context, service string) (HealthStatus, error) {
+	conn, err := c.getGRPCConn()
+	if err != nil {
+		return HealthStatusUnknown, fmt.Errorf("get grpc connection: %w", err)
+	}
+
+	callOptions, err := c.grpcCallOptionsFor(ctx)
+	if err != nil {
+		return HealthStatusUnknown, err
+	}
+
+	// Health checks fail fast, a connection failure must be reported right away and not wait
+	// for the connection to become ready like regular calls
+	callOptions = append(callOptions, grpc.WaitForReady(false))
+
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service}, callOptions...)
+	if err != nil {
+		// The health protocol specifies that an unknown service is reported with a NotFound code
+		if status.Code(err) == codes.NotFound {
+			c.logger.Debug("health check service is unknown to the server", zap.String("service", service), zap.Error(err))
+			return HealthStatusServiceUnknown, nil
+		}
+
+		return HealthStatusUnknown, fmt.Errorf("health check %q: %w", service, err)
+	}
+
+	return response.Status, nil
+}
@@ -0,0 +1,131 @@
+package dfuse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// GraphQLHedge option to hedge a `GraphQLQuery`: if the query has not answered within `delay`,
+// a second identical query is sent (to the endpoint defined through `WithHedgeEndpoint` if any)
+// and the first one to succeed is returned, the other one being canceled. A query failing before
+// `delay` is not hedged.
+//
+// Hedging doubles the load of slow queries, use it only for read-only queries whose result does
+// not depend on which server answers (like lookups of irreversible data). It's ignored by
+// `GraphQLSubscription`.
+func GraphQLHedge(delay time.Duration) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) { o.hedgeDelay = delay })
+}
+
+// WithHedgeEndpoint is an option to send the hedged queries (see `GraphQLHedge`) to `endpoint`
+// instead of the client's endpoint, a network name like `eos-mainnet` being resolved through the
+// network registry like the client's network. The endpoint is dialed with the same options
+// (transport, port and proxy) as the client's endpoint unless its scheme defines a transport.
+func WithHedgeEndpoint(endpoint string) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.hedgeEndpoint = endpoint })
+}
+
+// useHedgeEndpoint is an internal option routing the call to the hedge endpoint.
+var useHedgeEndpoint = graphqlOptionFunc(func(o *graphqlOptions) { o.hedgeEndpoint = true })
+
+type hedgeResult struct {
+	response *pbgraphql.Response
+	err      error
+	info     *CallInfo
+	hedged   bool
+}
+
+// hedgedQueryAttempt races the query against a hedged copy sent after `delay`, see `GraphQLHedge`.
+func (c *client) hedgedQueryAttempt(ctx context.Context, span trace.Span, document string, opts []GraphQLOption, options *graphqlOptions) (*pbgraphql.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// Cancels the call that did not win the race
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	launch := func(hedged bool) {
+		// Each call gets its own details, only the winner's are reported to the caller
+		attemptOpts := opts[:len(opts):len(opts)]
+		var info *CallInfo
+		if options.callInfo != nil {
+			info = &CallInfo{}
+			attemptOpts = append(attemptOpts, GraphQLCallInfo(info))
+		}
+
+		if hedged && c.hedgeAddr != "" {
+			attemptOpts = append(attemptOpts, useHedgeEndpoint)
+		}
+
+		go func() {
+			response, err := c.graphqlQueryAttempt(ctx, span, document, attemptOpts)
+			results <- hedgeResult{response, err, info, hedged}
+		}()
+	}
+
+	launch(false)
+	timer := time.NewTimer(options.hedgeDelay)
+	defer timer.Stop()
+
+	inFlight, hedged := 1, false
+	var primary hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			c.logger.Debug("graphql query did not answer within hedge delay, sending hedged query", zap.Duration("delay", options.hedgeDelay))
+			span.AddEvent("dfuse.hedge")
+			c.metrics.queryHedged()
+
+			hedged = true
+			inFlight++
+			launch(true)
+
+		case result := <-results:
+			inFlight--
+			if result.err == nil {
+				if options.callInfo != nil {
+					*options.callInfo = *result.info
+				}
+
+				return result.response, nil
+			}
+
+			if !result.hedged {
+				primary = result
+			}
+
+			if !hedged || inFlight == 0 {
+				// Failed before being hedged or both failed, report the primary query's failure
+				if options.callInfo != nil {
+					*options.callInfo = *primary.info
+				}
+
+				return nil, primary.err
+			}
+		}
+	}
+}
+
+func (c *client) getHedgeGraphqlClient() (pbgraphql.GraphQLClient, error) {
+	c.grpcLock.Lock()
+	defer c.grpcLock.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	if c.hedgeConn == nil {
+		conn, err := newGRPCClient(c.hedgeAddr, c.hedgeDialOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("get hedge grpc connection: %w", err)
+		}
+
+		c.hedgeConn = conn
+		c.hedgeGraphqlClient = pbgraphql.NewGraphQLClient(conn)
+	}
+
+	return c.hedgeGraphqlClient, nil
+}
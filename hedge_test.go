@@ -0,0 +1,141 @@
+package dfuse
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient_GraphQLHedge(t *testing.T) {
+	hang := func(stream pbgraphql.GraphQL_ExecuteServer) error {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	tests := []struct {
+		name              string
+		primary           []func(stream pbgraphql.GraphQL_ExecuteServer) error
+		alternate         bool
+		expectedData      string
+		expectedCode      codes.Code
+		expectedPrimary   int32
+		expectedAlternate int32
+	}{
+		{
+			"fast query not hedged",
+			[]func(stream pbgraphql.GraphQL_ExecuteServer) error{respond(`{"primary":1}`)},
+			false, `{"primary":1}`, codes.OK, 1, 0,
+		},
+		{
+			"slow query hedged on same endpoint",
+			[]func(stream pbgraphql.GraphQL_ExecuteServer) error{hang, respond(`{"primary":2}`)},
+			false, `{"primary":2}`, codes.OK, 2, 0,
+		},
+		{
+			"slow query hedged on alternate endpoint",
+			[]func(stream pbgraphql.GraphQL_ExecuteServer) error{hang},
+			true, `{"alternate":1}`, codes.OK, 1, 1,
+		},
+		{
+			"failure before delay not hedged",
+			[]func(stream pbgraphql.GraphQL_ExecuteServer) error{fail(codes.InvalidArgument)},
+			false, "", codes.InvalidArgument, 1, 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			primary := test.primary
+			primaryExecutions := atomic.NewInt32(0)
+			conn := newTestGRPCConn(t, &testGraphQLServer{
+				execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+					execution := int(primaryExecutions.Inc()) - 1
+					return primary[execution%len(primary)](stream)
+				},
+			})
+
+			options := []ClientOption{WithGRPCConn(conn), WithoutAuthentication()}
+
+			alternateExecutions := atomic.NewInt32(0)
+			if test.alternate {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+
+				server := grpc.NewServer()
+				pbgraphql.RegisterGraphQLServer(server, &testGraphQLServer{
+					execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+						alternateExecutions.Inc()
+						return respond(`{"alternate":1}`)(stream)
+					},
+				})
+				go server.Serve(listener)
+				defer server.Stop()
+
+				options = append(options, WithHedgeEndpoint("grpc://"+listener.Addr().String()))
+			}
+
+			client, err := NewClient("", "", options...)
+			require.NoError(t, err)
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			info := &CallInfo{}
+			response, err := client.GraphQLQuery(ctx, "{ ping }", GraphQLHedge(100*time.Millisecond), GraphQLCallInfo(info))
+			if test.expectedCode == codes.OK {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedData, response.Data)
+			} else {
+				assert.Equal(t, test.expectedCode, grpcCode(err))
+			}
+
+			assert.Equal(t, test.expectedCode, info.Status.Code())
+			assert.Equal(t, test.expectedPrimary, primaryExecutions.Load())
+			assert.Equal(t, test.expectedAlternate, alternateExecutions.Load())
+		})
+	}
+}
+
+func respond(data string) func(stream pbgraphql.GraphQL_ExecuteServer) error {
+	return func(stream pbgraphql.GraphQL_ExecuteServer) error {
+		return stream.Send(&pbgraphql.Response{Data: data})
+	}
+}
+
+func fail(code codes.Code) func(stream pbgraphql.GraphQL_ExecuteServer) error {
+	return func(stream pbgraphql.GraphQL_ExecuteServer) error {
+		return status.Error(code, "failed")
+	}
+}
+
+func TestClient_HedgeEndpoint(t *testing.T) {
+	registry := NewNetworkRegistry(&Network{Name: "hedge-net", Endpoint: "grpc://10.0.0.2:9001"})
+
+	tests := []struct {
+		name         string
+		endpoint     string
+		expectedAddr string
+	}{
+		{"network name", "hedge-net", "10.0.0.2:9001"},
+		{"endpoint", "grpcs://hedge.eos.dfuse.io", "hedge.eos.dfuse.io:443"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dfuseClient, err := NewClient("localhost:9000", "", WithoutAuthentication(), WithNetworkRegistry(registry), WithHedgeEndpoint(test.endpoint))
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectedAddr, dfuseClient.(*client).hedgeAddr)
+		})
+	}
+}
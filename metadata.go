@@ -0,0 +1,64 @@
+package dfuse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDMetadataKey is the gRPC metadata key carrying the request ID of each GraphQL call,
+// see `GraphQLRequestID`.
+const RequestIDMetadataKey = "x-request-id"
+
+// WithMetadata is an option to attach gRPC metadata (i.e. headers like tenant tags) to all
+// GraphQL calls performed by the client, per-call metadata can be added or overridden
+// through the `GraphQLMetadata` option. Keys are lower-cased as mandated by gRPC.
+func WithMetadata(pairs map[string]string) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) {
+		if o.metadata == nil {
+			o.metadata = map[string]string{}
+		}
+
+		for key, value := range pairs {
+			o.metadata[strings.ToLower(key)] = value
+		}
+	})
+}
+
+// outgoingContext returns `ctx` augmented with the client-wide metadata, the metadata already
+// present in `ctx`, the call's metadata, the active span's trace context and the call's request
+// ID, in increasing order of precedence.
+func (c *client) outgoingContext(ctx context.Context, requestID string, callMetadata map[string]string) context.Context {
+	md := metadata.MD{}
+	for key, value := range c.metadata {
+		md.Set(key, value)
+	}
+
+	if existing, found := metadata.FromOutgoingContext(ctx); found {
+		for key, values := range existing {
+			md.Set(key, values...)
+		}
+	}
+
+	for key, value := range callMetadata {
+		md.Set(key, value)
+	}
+
+	traceContextPropagator.Inject(ctx, metadataCarrier(md))
+	md.Set(RequestIDMetadataKey, requestID)
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// Crypto random source is never expected to fail, a request ID is not security sensitive
+		return "0000000000000000"
+	}
+
+	return hex.EncodeToString(id)
+}
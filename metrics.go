@@ -0,0 +1,229 @@
+package dfuse
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "dfuse_client"
+
+// WithMetrics is an option to collect Prometheus metrics about the client's operations (API token
+// refreshes and store latency, queries, subscriptions, reconnections and transient errors) and
+// register them in `registerer`.
+//
+// Subscription metrics are labelled by `operation`, the name of the subscription's operation
+// (`GraphQLOperationName` or the name of the document's single operation, `unnamed` for an
+// anonymous one). Multiple clients can share the same registerer, the metrics are then aggregated
+// across them.
+func WithMetrics(registerer prometheus.Registerer) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.metricsRegisterer = registerer })
+}
+
+// clientMetrics holds the client's collectors, all its methods are no-op on a `nil` receiver
+// so that call sites don't have to care whether metrics are enabled or not.
+type clientMetrics struct {
+	tokenRefreshes        *prometheus.CounterVec
+	tokenStoreLatency     *prometheus.HistogramVec
+	queries               *prometheus.CounterVec
+	queryLatency          *prometheus.HistogramVec
+	hedgedQueries         prometheus.Counter
+	activeSubscriptions   *prometheus.GaugeVec
+	subscriptionMessages  *prometheus.CounterVec
+	subscriptionBytes     *prometheus.CounterVec
+	subscriptionReconnect *prometheus.CounterVec
+	transientErrors       *prometheus.CounterVec
+}
+
+func newClientMetrics(registerer prometheus.Registerer) (*clientMetrics, error) {
+	if registerer == nil {
+		return nil, nil
+	}
+
+	m := &clientMetrics{
+		tokenRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "token_refreshes_total",
+			Help: "Number of API token refreshes performed against the authentication server, by result (success or failure).",
+		}, []string{"result"}),
+		tokenStoreLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "token_store_duration_seconds",
+			Help:    "Latency of API token store operations, by operation (get or set).",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"operation"}),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "queries_total",
+			Help: "Number of GraphQL queries performed, by gRPC status code.",
+		}, []string{"code"}),
+		queryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "query_duration_seconds",
+			Help:    "Latency of GraphQL queries, by gRPC status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"code"}),
+		hedgedQueries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "hedged_queries_total",
+			Help: "Number of hedged GraphQL queries sent because the original query did not answer within the hedge delay.",
+		}),
+		activeSubscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "active_subscriptions",
+			Help: "Number of GraphQL subscriptions currently streaming, by operation.",
+		}, []string{"operation"}),
+		subscriptionMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "subscription_messages_received_total",
+			Help: "Number of messages received by GraphQL subscriptions, by operation.",
+		}, []string{"operation"}),
+		subscriptionBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "subscription_bytes_received_total",
+			Help: "Number of message bytes (Protobuf encoded size) received by GraphQL subscriptions, by operation.",
+		}, []string{"operation"}),
+		subscriptionReconnect: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "subscription_reconnects_total",
+			Help: "Number of reconnection attempts performed by GraphQL subscriptions after a transient error, by operation.",
+		}, []string{"operation"}),
+		transientErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "transient_errors_total",
+			Help: "Number of errors classified as transient, by gRPC status code.",
+		}, []string{"code"}),
+	}
+
+	var err error
+	register := func(collector prometheus.Collector) prometheus.Collector {
+		if err != nil {
+			return collector
+		}
+
+		if registerErr := registerer.Register(collector); registerErr != nil {
+			// Another client registered the same metrics in this registerer, share its collector
+			var alreadyRegistered prometheus.AlreadyRegisteredError
+			if errors.As(registerErr, &alreadyRegistered) {
+				return alreadyRegistered.ExistingCollector
+			}
+
+			err = registerErr
+		}
+
+		return collector
+	}
+
+	m.tokenRefreshes = register(m.tokenRefreshes).(*prometheus.CounterVec)
+	m.tokenStoreLatency = register(m.tokenStoreLatency).(*prometheus.HistogramVec)
+	m.queries = register(m.queries).(*prometheus.CounterVec)
+	m.queryLatency = register(m.queryLatency).(*prometheus.HistogramVec)
+	m.hedgedQueries = register(m.hedgedQueries).(prometheus.Counter)
+	m.activeSubscriptions = register(m.activeSubscriptions).(*prometheus.GaugeVec)
+	m.subscriptionMessages = register(m.subscriptionMessages).(*prometheus.CounterVec)
+	m.subscriptionBytes = register(m.subscriptionBytes).(*prometheus.CounterVec)
+	m.subscriptionReconnect = register(m.subscriptionReconnect).(*prometheus.CounterVec)
+	m.transientErrors = register(m.transientErrors).(*prometheus.CounterVec)
+
+	if err != nil {
+		return nil, fmt.Errorf("register metrics: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m *clientMetrics) tokenRefreshed(err error) {
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		m.tokenRefreshes.WithLabelValues("failure").Inc()
+	} else {
+		m.tokenRefreshes.WithLabelValues("success").Inc()
+	}
+}
+
+func (m *clientMetrics) tokenStoreOperation(operation string, startedAt time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.tokenStoreLatency.WithLabelValues(operation).Observe(time.Since(startedAt).Seconds())
+}
+
+func (m *clientMetrics) queryCompleted(err error, startedAt time.Time) {
+	if m == nil {
+		return
+	}
+
+	code := grpcCode(err).String()
+	m.queries.WithLabelValues(code).Inc()
+	m.queryLatency.WithLabelValues(code).Observe(time.Since(startedAt).Seconds())
+}
+
+func (m *clientMetrics) queryHedged() {
+	if m == nil {
+		return
+	}
+
+	m.hedgedQueries.Inc()
+}
+
+func (m *clientMetrics) subscriptionStarted(operation string) {
+	if m == nil {
+		return
+	}
+
+	m.activeSubscriptions.WithLabelValues(operationLabel(operation)).Inc()
+}
+
+func (m *clientMetrics) subscriptionEnded(operation string) {
+	if m == nil {
+		return
+	}
+
+	m.activeSubscriptions.WithLabelValues(operationLabel(operation)).Dec()
+}
+
+func (m *clientMetrics) subscriptionMessageReceived(operation string, size int) {
+	if m == nil {
+		return
+	}
+
+	m.subscriptionMessages.WithLabelValues(operationLabel(operation)).Inc()
+	m.subscriptionBytes.WithLabelValues(operationLabel(operation)).Add(float64(size))
+}
+
+func (m *clientMetrics) subscriptionReconnecting(operation string) {
+	if m == nil {
+		return
+	}
+
+	m.subscriptionReconnect.WithLabelValues(operationLabel(operation)).Inc()
+}
+
+func operationLabel(operation string) string {
+	if operation == "" {
+		return "unnamed"
+	}
+
+	return operation
+}
+
+func (m *clientMetrics) transientError(err error) {
+	if m == nil {
+		return
+	}
+
+	m.transientErrors.WithLabelValues(grpcCode(err).String()).Inc()
+}
+
+// grpcCode returns the gRPC status code of `err`, unwrapping it if needed, unlike `status.Code`
+// which only considers the error itself. Context errors are mapped to their gRPC equivalent.
+func grpcCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcErr.GRPCStatus().Code()
+	}
+
+	return status.FromContextError(err).Code()
+}
@@ -0,0 +1,97 @@
+package dfuse
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient_Metrics(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			if request.Query == "invalid" {
+				return status.Error(codes.InvalidArgument, "invalid query")
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := stream.Send(&pbgraphql.Response{Data: `{"a":1}`}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	registry := prometheus.NewRegistry()
+	dfuseClient, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithMetrics(registry))
+	require.NoError(t, err)
+
+	// A second client sharing the registry must re-use the already registered collectors
+	other, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithMetrics(registry))
+	require.NoError(t, err)
+
+	_, err = dfuseClient.GraphQLQuery(context.Background(), "{ ping }")
+	require.NoError(t, err)
+
+	_, err = other.GraphQLQuery(context.Background(), "invalid")
+	require.Error(t, err)
+
+	stream, err := dfuseClient.GraphQLSubscription(context.Background(), "subscription Blocks { a }")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(dfuseClient.(*client).metrics.activeSubscriptions.WithLabelValues("Blocks")))
+
+	for {
+		if _, err := stream.Recv(); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+	}
+
+	expected := `
+		# HELP dfuse_client_active_subscriptions Number of GraphQL subscriptions currently streaming, by operation.
+		# TYPE dfuse_client_active_subscriptions gauge
+		dfuse_client_active_subscriptions{operation="Blocks"} 0
+		# HELP dfuse_client_queries_total Number of GraphQL queries performed, by gRPC status code.
+		# TYPE dfuse_client_queries_total counter
+		dfuse_client_queries_total{code="InvalidArgument"} 1
+		dfuse_client_queries_total{code="OK"} 1
+		# HELP dfuse_client_subscription_messages_received_total Number of messages received by GraphQL subscriptions, by operation.
+		# TYPE dfuse_client_subscription_messages_received_total counter
+		dfuse_client_subscription_messages_received_total{operation="Blocks"} 2
+	`
+
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"dfuse_client_active_subscriptions",
+		"dfuse_client_queries_total",
+		"dfuse_client_subscription_messages_received_total",
+	)
+	assert.NoError(t, err)
+}
+
+func TestClient_Metrics_SubscriptionCanceled(t *testing.T) {
+	transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{"a":1}`}}}
+
+	dfuseClient, err := NewClient("", "", WithGraphQLTransport(transport), WithoutAuthentication(), WithMetrics(prometheus.NewRegistry()))
+	require.NoError(t, err)
+	active := dfuseClient.(*client).metrics.activeSubscriptions.WithLabelValues("unnamed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = dfuseClient.GraphQLSubscription(ctx, "subscription { a }")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(active))
+
+	// The stream is abandoned without receiving its end
+	cancel()
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(active) == 0 }, time.Second, time.Millisecond)
+}
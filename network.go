@@ -0,0 +1,138 @@
+package dfuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultAuthURL is the authentication server used to issue API tokens when neither
+// `WithAuthURL` nor the resolved network defines one.
+const DefaultAuthURL = "https://auth.dfuse.io"
+
+// Network is a well-known deployment reachable through a short name like `eos-mainnet`.
+type Network struct {
+	Name string `json:"-"`
+
+	// Endpoint is the network's gRPC endpoint in any form accepted by `ParseEndpoint`, URL-style
+	// endpoints should be preferred so that port and transport are fully defined.
+	Endpoint string `json:"endpoint"`
+
+	// AuthURL is the authentication server issuing API tokens for this network, `DefaultAuthURL`
+	// is used when empty.
+	AuthURL string `json:"auth_url,omitempty"`
+}
+
+// NetworkRegistry maps short network names to their `Network` definition. A `NewClient` call
+// receiving a registered name connects to the network's endpoint and uses its auth URL.
+type NetworkRegistry struct {
+	networks map[string]*Network
+	lock     sync.RWMutex
+}
+
+// NewNetworkRegistry creates an empty registry containing only the received networks, use
+// `NewDefaultNetworkRegistry` to start from the well-known networks instead.
+func NewNetworkRegistry(networks ...*Network) *NetworkRegistry {
+	registry := &NetworkRegistry{networks: map[string]*Network{}}
+	for _, network := range networks {
+		registry.networks[network.Name] = network
+	}
+
+	return registry
+}
+
+// NewDefaultNetworkRegistry creates a registry containing the well-known dfuse networks.
+func NewDefaultNetworkRegistry() *NetworkRegistry {
+	return NewNetworkRegistry(
+		&Network{Name: "eos-mainnet", Endpoint: "grpcs://mainnet.eos.dfuse.io:443", AuthURL: DefaultAuthURL},
+		&Network{Name: "eos-testnet", Endpoint: "grpcs://testnet.eos.dfuse.io:443", AuthURL: DefaultAuthURL},
+		&Network{Name: "eos-kylin", Endpoint: "grpcs://kylin.eos.dfuse.io:443", AuthURL: DefaultAuthURL},
+		&Network{Name: "eth-mainnet", Endpoint: "grpcs://mainnet.eth.dfuse.io:443", AuthURL: DefaultAuthURL},
+		&Network{Name: "eth-ropsten", Endpoint: "grpcs://ropsten.eth.dfuse.io:443", AuthURL: DefaultAuthURL},
+	)
+}
+
+// Lookup returns the network registered under `name`, if any.
+func (r *NetworkRegistry) Lookup(name string) (network *Network, found bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	network, found = r.networks[name]
+	return
+}
+
+// Register adds the network to the registry, replacing any network already registered
+// under the same name.
+func (r *NetworkRegistry) Register(network *Network) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.networks[network.Name] = network
+}
+
+// Names returns the sorted names of all registered networks.
+func (r *NetworkRegistry) Names() (out []string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for name := range r.networks {
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+	return
+}
+
+// LoadFile reads the JSON registry file at `filePath` and registers all networks it defines,
+// overriding any existing network with the same name. The file is a JSON object keyed by
+// network name:
+//
+//	{
+//	  "eos-mainnet": {"endpoint": "grpcs://eos.example.com:443", "auth_url": "https://auth.example.com"},
+//	  "local": {"endpoint": "grpc://localhost:9000"}
+//	}
+func (r *NetworkRegistry) LoadFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("open network registry file %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var networks map[string]*Network
+	if err := json.NewDecoder(file).Decode(&networks); err != nil {
+		return fmt.Errorf("read network registry file %q: %w", filePath, err)
+	}
+
+	for name, network := range networks {
+		if network == nil {
+			return fmt.Errorf("invalid network %q in registry file %q: definition is null", name, filePath)
+		}
+
+		if _, err := ParseEndpoint(network.Endpoint); err != nil {
+			return fmt.Errorf("invalid network %q in registry file %q: %w", name, filePath, err)
+		}
+
+		network.Name = name
+		r.Register(network)
+	}
+
+	return nil
+}
+
+func (r *NetworkRegistry) clone() *NetworkRegistry {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	out := NewNetworkRegistry()
+	for name, network := range r.networks {
+		out.networks[name] = network
+	}
+
+	return out
+}
+
+func (r *NetworkRegistry) String() string {
+	return fmt.Sprintf("%v", r.Names())
+}
@@ -0,0 +1,78 @@
+package dfuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkRegistry_LoadFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    map[string]*Network
+		expectedErr string
+	}{
+		{
+			"override and add",
+			`{"eos-mainnet":{"endpoint":"grpcs://eos.example.com","auth_url":"https://auth.example.com"},"local":{"endpoint":"grpc://localhost:9000"}}`,
+			map[string]*Network{
+				"eos-mainnet": {Name: "eos-mainnet", Endpoint: "grpcs://eos.example.com", AuthURL: "https://auth.example.com"},
+				"eth-mainnet": {Name: "eth-mainnet", Endpoint: "grpcs://mainnet.eth.dfuse.io:443", AuthURL: DefaultAuthURL},
+				"local":       {Name: "local", Endpoint: "grpc://localhost:9000"},
+			},
+			"",
+		},
+		{
+			"invalid endpoint",
+			`{"local":{"endpoint":"http://localhost"}}`,
+			nil,
+			`invalid network "local" in registry file "<file>": invalid endpoint "http://localhost": unknown scheme "http", accepted schemes are grpc, grpcs, grpcs+insecure and unix`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, cleanup := tmpDir(t, "networks")
+			defer cleanup()
+
+			path := filepath.Join(dir, "networks.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(test.content), os.ModePerm))
+
+			registry := NewDefaultNetworkRegistry()
+			err := registry.LoadFile(path)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				for name, expected := range test.expected {
+					actual, found := registry.Lookup(name)
+					require.True(t, found, "network %q not found", name)
+					assert.Equal(t, expected, actual)
+				}
+			} else {
+				assert.EqualError(t, err, strings.ReplaceAll(test.expectedErr, "<file>", path))
+			}
+		})
+	}
+}
+
+func TestNewClient_Network(t *testing.T) {
+	registry := NewNetworkRegistry(&Network{Name: "local", Endpoint: "grpc://localhost:13023", AuthURL: "http://localhost:8080"})
+
+	actual, err := NewClient("local", "key", WithNetworkRegistry(registry), WithAPITokenStore(NewInMemoryAPITokenStore()))
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:13023", actual.(*client).grpcAddr)
+	assert.Equal(t, "http://localhost:8080/v1/auth/issue", actual.(*client).authIssueURL)
+
+	actual, err = NewClient("local", "key", WithNetworkRegistry(registry), WithAuthURL("https://auth.example.com"), WithAPITokenStore(NewInMemoryAPITokenStore()))
+	require.NoError(t, err)
+	assert.Equal(t, "https://auth.example.com/v1/auth/issue", actual.(*client).authIssueURL)
+
+	actual, err = NewClient("eos-mainnet", "key", WithAPITokenStore(NewInMemoryAPITokenStore()))
+	require.NoError(t, err)
+	assert.Equal(t, "mainnet.eos.dfuse.io:443", actual.(*client).grpcAddr)
+}
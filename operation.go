@@ -0,0 +1,83 @@
+package dfuse
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// GraphQLOperationName option to run the operation named `name` of a document defining
+// multiple operations. The name is sent to the server and, for servers ignoring it, the
+// document sent is reduced to the selected operation and the fragments it uses. A name not
+// matching any operation of the document is reported as an error before sending.
+func GraphQLOperationName(name string) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) { o.operationName = name })
+}
+
+// parseDocument parses the GraphQL `document`.
+func parseDocument(document string) (*ast.QueryDocument, error) {
+	parsed, err := parser.ParseQuery(&ast.Source{Input: document})
+	if err != nil {
+		return nil, fmt.Errorf("parse graphql document: %w", err)
+	}
+
+	return parsed, nil
+}
+
+// selectOperation returns `document`, parsed as `parsed`, reduced to the operation `name` and
+// the fragments it references along its parsed form, `document` and `parsed` are returned as-is
+// when it defines a single operation named `name`.
+func selectOperation(document string, parsed *ast.QueryDocument, name string) (string, *ast.QueryDocument, error) {
+	operation := parsed.Operations.ForName(name)
+	if operation == nil {
+		return "", nil, fmt.Errorf("operation %q not found in document", name)
+	}
+
+	if len(parsed.Operations) == 1 {
+		return document, parsed, nil
+	}
+
+	selected := &ast.QueryDocument{Operations: ast.OperationList{operation}}
+	visitFragmentSpreads(operation.SelectionSet, map[string]bool{}, func(name string) *ast.FragmentDefinition {
+		fragment := parsed.Fragments.ForName(name)
+		if fragment != nil {
+			selected.Fragments = append(selected.Fragments, fragment)
+		}
+
+		return fragment
+	})
+
+	buffer := bytes.NewBuffer(nil)
+	formatter.NewFormatter(buffer, formatter.WithIndent("  ")).FormatQueryDocument(selected)
+
+	return buffer.String(), selected, nil
+}
+
+// variableDefinitionsOf returns the variable definitions of the operation `name` of the parsed
+// document (empty for a document with a single operation), none when the document is invalid
+// (`parsed` is nil).
+func variableDefinitionsOf(parsed *ast.QueryDocument, name string) ast.VariableDefinitionList {
+	if parsed == nil {
+		return nil
+	}
+
+	if operation := parsed.Operations.ForName(name); operation != nil {
+		return operation.VariableDefinitions
+	}
+
+	return nil
+}
+
+// operationNameOf returns the name of the single operation of the parsed document, empty when
+// the operation is anonymous or the document is invalid (`parsed` is nil) or defines multiple
+// operations.
+func operationNameOf(parsed *ast.QueryDocument) string {
+	if parsed == nil || len(parsed.Operations) != 1 {
+		return ""
+	}
+
+	return parsed.Operations[0].Name
+}
@@ -0,0 +1,60 @@
+package dfuse
+
+import (
+	"context"
+	"testing"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GraphQLOperationName(t *testing.T) {
+	document := `
+query Blocks { blocks { ...Block } }
+query Transfers($limit: Int) { transfers(limit: $limit) { ...Transfer } }
+fragment Block on Block { number }
+fragment Transfer on Transfer { from ...Account }
+fragment Account on Transfer { account }
+`
+
+	tests := []struct {
+		name          string
+		document      string
+		operationName string
+		expected      string
+		expectedErr   string
+	}{
+		{"no operation name", document, "", document, ""},
+		{
+			"selected operation with fragments",
+			document,
+			"Transfers",
+			"query Transfers ($limit: Int) {\n  transfers(limit: $limit) {\n    ... Transfer\n  }\n}\nfragment Transfer on Transfer {\n  from\n  ... Account\n}\nfragment Account on Transfer {\n  account\n}\n",
+			"",
+		},
+		{"single operation kept as-is", "query Blocks { blocks { number } }", "Blocks", "query Blocks { blocks { number } }", ""},
+		{"unknown operation", document, "Missing", "", `operation "Missing" not found in document`},
+		{"anonymous operation", "{ blocks { number } }", "Blocks", "", `operation "Blocks" not found in document`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(context.Background(), test.document, GraphQLOperationName(test.operationName))
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				assert.Nil(t, transport.request)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, transport.request.Query)
+			assert.Equal(t, test.operationName, transport.request.OperationName)
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package dfuse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+)
+
+// WithPersistedQueries is an option to send documents as persisted queries, following the
+// Automatic Persisted Queries protocol over HTTP and WebSocket (see `WithHTTPTransport` and
+// `WithWebSocketTransport`), calls over gRPC or custom transports are not affected. This saves
+// the bandwidth of large documents sent repeatedly. `NewClient` fails when the option is used
+// without any of those transports.
+//
+// The first request of a document carries it along its SHA-256 hash (its
+// `extensions.persistedQuery`) for the server to store it. Once the server acknowledged the
+// hash (answered without rejecting it), following requests of the document only carry its hash.
+// When the server answers that it does not know a hash (a `PersistedQueryNotFound` error, in a
+// response or the body of an HTTP error status, for instance after a restart), the request is sent again with its full document before any of its
+// responses is returned. A rejection received afterwards, like when a WebSocket subscription
+// re-subscribes to a server that forgot the document, is returned as any other GraphQL error.
+//
+// Acknowledged hashes are recorded per connection (HTTP or WebSocket endpoint). Once a server
+// answers that it does not support persisted queries (a `PersistedQueryNotSupported` error),
+// full documents are sent to it from then on.
+func WithPersistedQueries() ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.persistedQueries = true })
+}
+
+type persistedQueryHashKey struct{}
+
+// persistedQueryHash returns the SHA-256 hash (hex encoded) of the document of the persisted
+// query executed with `ctx`, empty if the request is not a persisted query. A request whose
+// `Query` is empty is sent with only this hash.
+func persistedQueryHash(ctx context.Context) string {
+	hash, _ := ctx.Value(persistedQueryHashKey{}).(string)
+	return hash
+}
+
+func withPersistedQueryHash(ctx context.Context, hash string) context.Context {
+	return context.WithValue(ctx, persistedQueryHashKey{}, hash)
+}
+
+func persistedQueryHashOf(document string) string {
+	hash := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(hash[:])
+}
+
+// usePersistedQueries wraps the client's HTTP and WebSocket transports to send persisted
+// queries, a transport shared by queries and subscriptions (one connection) sharing its wrapper
+// too. gRPC has no standard way to carry the hash, servers not knowing it would reject the
+// request's empty document, having no transport to wrap is reported as an error.
+func (c *client) usePersistedQueries() error {
+	wrapped := map[GraphQLTransport]GraphQLTransport{}
+	wrap := func(transport GraphQLTransport) GraphQLTransport {
+		switch transport.(type) {
+		case *httpTransport, *webSocketTransport:
+		default:
+			return transport
+		}
+
+		if existing, found := wrapped[transport]; found {
+			return existing
+		}
+
+		out := &persistedQueryTransport{transport: transport, acknowledged: map[string]bool{}}
+		wrapped[transport] = out
+		return out
+	}
+
+	c.queryTransport, c.streamTransport = wrap(c.queryTransport), wrap(c.streamTransport)
+	if len(wrapped) == 0 {
+		return errors.New("persisted queries require an HTTP or WebSocket transport, see WithHTTPTransport and WithWebSocketTransport")
+	}
+
+	return nil
+}
+
+// persistedQueryTransport sends requests through `transport` as persisted queries, see
+// `WithPersistedQueries`.
+type persistedQueryTransport struct {
+	transport GraphQLTransport
+
+	// unsupported is set once the server answered that it does not support persisted queries
+	unsupported int32
+
+	// acknowledged are the hashes of the documents the server stored
+	acknowledgedLock sync.Mutex
+	acknowledged     map[string]bool
+}
+
+func (t *persistedQueryTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	if atomic.LoadInt32(&t.unsupported) == 1 {
+		return t.transport.Execute(ctx, request, token)
+	}
+
+	hash := persistedQueryHashOf(request.Query)
+	sent := request
+	if t.isAcknowledged(hash) {
+		sent = &pbgraphql.Request{Variables: request.Variables, OperationName: request.OperationName}
+	}
+
+	// Each attempt runs on its own context, canceled when falling back to release its connection
+	attemptCtx, cancel := context.WithCancel(ctx)
+	stream, err := t.transport.Execute(withPersistedQueryHash(attemptCtx, hash), sent, token)
+	if err != nil {
+		cancel()
+		if outcome := persistedQueryErrorOutcome(err); canFallBack(outcome, sent) {
+			return t.fallback(ctx, request, token, hash, outcome)
+		}
+
+		return nil, err
+	}
+
+	return &persistedQueryStream{
+		GraphQL_ExecuteClient: stream,
+		transport:             t,
+		ctx:                   ctx,
+		cancel:                cancel,
+		request:               request,
+		token:                 token,
+		sent:                  sent,
+		hash:                  hash,
+	}, nil
+}
+
+// fallback sends `request` again after the server rejected the hash of its document, along the
+// hash for the server to store it unless persisted queries are not supported.
+func (t *persistedQueryTransport) fallback(ctx context.Context, request *pbgraphql.Request, token string, hash string, outcome persistedQueryOutcome) (pbgraphql.GraphQL_ExecuteClient, error) {
+	if outcome == persistedQueryNotSupported {
+		atomic.StoreInt32(&t.unsupported, 1)
+		return t.transport.Execute(ctx, request, token)
+	}
+
+	t.setAcknowledged(hash, false)
+	return t.transport.Execute(withPersistedQueryHash(ctx, hash), request, token)
+}
+
+func (t *persistedQueryTransport) isAcknowledged(hash string) bool {
+	t.acknowledgedLock.Lock()
+	defer t.acknowledgedLock.Unlock()
+
+	return t.acknowledged[hash]
+}
+
+func (t *persistedQueryTransport) setAcknowledged(hash string, acknowledged bool) {
+	t.acknowledgedLock.Lock()
+	defer t.acknowledgedLock.Unlock()
+
+	if acknowledged {
+		t.acknowledged[hash] = true
+	} else {
+		delete(t.acknowledged, hash)
+	}
+}
+
+// persistedQueryStream is the stream of a persisted query. Its first response tells whether the
+// server accepted the hash, the stream being then transparently replaced by the one of the full
+// document when the server rejected it.
+type persistedQueryStream struct {
+	pbgraphql.GraphQL_ExecuteClient
+
+	transport *persistedQueryTransport
+	ctx       context.Context
+	cancel    context.CancelFunc
+	request   *pbgraphql.Request
+	sent      *pbgraphql.Request
+	token     string
+	hash      string
+	received  bool
+}
+
+func (s *persistedQueryStream) Recv() (*pbgraphql.Response, error) {
+	response, err := s.GraphQL_ExecuteClient.Recv()
+	if s.received {
+		return response, err
+	}
+
+	s.received = true
+
+	outcome := persistedQueryErrorOutcome(err)
+	if err == nil {
+		outcome = persistedQueryResponseOutcome(response)
+	}
+
+	if outcome == persistedQueryAccepted && err == nil {
+		s.transport.setAcknowledged(s.hash, true)
+	}
+
+	if !canFallBack(outcome, s.sent) {
+		return response, err
+	}
+
+	s.cancel()
+	stream, err := s.transport.fallback(s.ctx, s.request, s.token, s.hash, outcome)
+	if err != nil {
+		return nil, err
+	}
+
+	s.GraphQL_ExecuteClient = stream
+
+	response, err = stream.Recv()
+	if outcome == persistedQueryNotFound && err == nil && persistedQueryResponseOutcome(response) == persistedQueryAccepted {
+		s.transport.setAcknowledged(s.hash, true)
+	}
+
+	return response, err
+}
+
+// canFallBack tells whether `sent` must be sent again after the server's `outcome`, a request
+// already carrying the full document being useless to send again when the hash is not found.
+func canFallBack(outcome persistedQueryOutcome, sent *pbgraphql.Request) bool {
+	switch outcome {
+	case persistedQueryNotFound:
+		return sent.Query == ""
+	case persistedQueryNotSupported:
+		return true
+	}
+
+	return false
+}
+
+type persistedQueryOutcome int
+
+const (
+	persistedQueryAccepted persistedQueryOutcome = iota
+	persistedQueryNotFound
+	persistedQueryNotSupported
+)
+
+// persistedQueryResponseOutcome tells from the errors of `response` whether the server rejected
+// the hash of a persisted query.
+func persistedQueryResponseOutcome(response *pbgraphql.Response) persistedQueryOutcome {
+	return persistedQueryErrorsOutcome(newGraphQLErrors(response.GetErrors()))
+}
+
+// persistedQueryErrorsOutcome tells from `graphqlErrs` whether the server rejected the hash of a
+// persisted query, identified either by their message or by their `code` extension.
+func persistedQueryErrorsOutcome(graphqlErrs GraphQLErrors) persistedQueryOutcome {
+	for _, graphqlErr := range graphqlErrs {
+		code, _ := graphqlErr.Extensions["code"].(string)
+		switch {
+		case graphqlErr.Message == "PersistedQueryNotFound" || code == "PERSISTED_QUERY_NOT_FOUND":
+			return persistedQueryNotFound
+		case graphqlErr.Message == "PersistedQueryNotSupported" || code == "PERSISTED_QUERY_NOT_SUPPORTED":
+			return persistedQueryNotSupported
+		}
+	}
+
+	return persistedQueryAccepted
+}
+
+// persistedQueryErrorOutcome tells whether `err`, returned by a transport, is the server
+// rejecting the hash of a persisted query, from the GraphQL errors it carries (like those of an
+// HTTP error status).
+func persistedQueryErrorOutcome(err error) persistedQueryOutcome {
+	var graphqlErrs GraphQLErrors
+	if !errors.As(err, &graphqlErrs) {
+		return persistedQueryAccepted
+	}
+
+	return persistedQueryErrorsOutcome(graphqlErrs)
+}
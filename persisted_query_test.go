@@ -0,0 +1,284 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const testPersistedDocument = "{ ping }"
+
+// testPersistedDocumentHash is the SHA-256 hash of `testPersistedDocument`
+const testPersistedDocumentHash = "6cd3bf61757c6bee6e943d50a381a002447236bf3f15d3730400b931e9cf323f"
+
+// persistedTransport records the query, persisted query hash and context of each request,
+// answering each with the next responses of `calls`.
+type persistedTransport struct {
+	queries  []string
+	hashes   []string
+	contexts []context.Context
+	calls    [][]*pbgraphql.Response
+}
+
+func (t *persistedTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	t.queries = append(t.queries, request.Query)
+	t.hashes = append(t.hashes, persistedQueryHash(ctx))
+	t.contexts = append(t.contexts, ctx)
+
+	var responses []*pbgraphql.Response
+	if len(t.calls) > 0 {
+		responses, t.calls = t.calls[0], t.calls[1:]
+	}
+
+	return &testTransportStream{transportStream: transportStream{ctx: ctx}, responses: responses}, nil
+}
+
+func persistedQueryError(message string, code string) *pbgraphql.Response {
+	graphqlErr := &pbgraphql.Error{Message: message}
+	if code != "" {
+		graphqlErr.Extensions, _ = structpb.NewStruct(map[string]interface{}{"code": code})
+	}
+
+	return &pbgraphql.Response{Errors: []*pbgraphql.Error{graphqlErr}}
+}
+
+// receivePersisted executes `testPersistedDocument` through `transport`, returning its first
+// response
+func receivePersisted(t *testing.T, transport GraphQLTransport) *pbgraphql.Response {
+	stream, err := transport.Execute(context.Background(), &pbgraphql.Request{Query: testPersistedDocument}, "")
+	require.NoError(t, err)
+
+	response, err := stream.Recv()
+	require.NoError(t, err)
+
+	return response
+}
+
+func TestPersistedQueryTransport(t *testing.T) {
+	doc, hash := testPersistedDocument, testPersistedDocumentHash
+	pong := &pbgraphql.Response{Data: `{"ping":"pong"}`}
+
+	tests := []struct {
+		name            string
+		calls           [][]*pbgraphql.Response
+		queryCount      int
+		expectedQueries []string
+		expectedHashes  []string
+	}{
+		{
+			"registered then acknowledged",
+			[][]*pbgraphql.Response{{pong}, {pong}, {pong}},
+			3,
+			[]string{doc, "", ""},
+			[]string{hash, hash, hash},
+		},
+		{
+			"unknown hash",
+			[][]*pbgraphql.Response{{pong}, {persistedQueryError("PersistedQueryNotFound", "")}, {pong}, {pong}},
+			3,
+			[]string{doc, "", doc, ""},
+			[]string{hash, hash, hash, hash},
+		},
+		{
+			"unknown hash by code",
+			[][]*pbgraphql.Response{{pong}, {persistedQueryError("not found", "PERSISTED_QUERY_NOT_FOUND")}, {pong}},
+			2,
+			[]string{doc, "", doc},
+			[]string{hash, hash, hash},
+		},
+		{
+			"not supported",
+			[][]*pbgraphql.Response{{persistedQueryError("PersistedQueryNotSupported", "")}, {pong}, {pong}},
+			2,
+			[]string{doc, doc, doc},
+			[]string{hash, "", ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &persistedTransport{calls: test.calls}
+			persisted := &persistedQueryTransport{transport: transport, acknowledged: map[string]bool{}}
+
+			for i := 0; i < test.queryCount; i++ {
+				assert.Equal(t, `{"ping":"pong"}`, receivePersisted(t, persisted).Data)
+			}
+
+			assert.Equal(t, test.expectedQueries, transport.queries)
+			assert.Equal(t, test.expectedHashes, transport.hashes)
+		})
+	}
+}
+
+func TestPersistedQueryTransport_NotFoundWithDocument(t *testing.T) {
+	transport := &persistedTransport{calls: [][]*pbgraphql.Response{{persistedQueryError("PersistedQueryNotFound", "")}}}
+	persisted := &persistedQueryTransport{transport: transport, acknowledged: map[string]bool{}}
+
+	assert.Equal(t, []string{"PersistedQueryNotFound"}, errorMessages(receivePersisted(t, persisted).Errors))
+	assert.Equal(t, []string{testPersistedDocument}, transport.queries)
+}
+
+func TestPersistedQueryTransport_FallbackCancelsAttempt(t *testing.T) {
+	transport := &persistedTransport{calls: [][]*pbgraphql.Response{{persistedQueryError("PersistedQueryNotFound", "")}, {{Data: `{}`}}}}
+	persisted := &persistedQueryTransport{transport: transport, acknowledged: map[string]bool{testPersistedDocumentHash: true}}
+
+	receivePersisted(t, persisted)
+
+	require.Len(t, transport.contexts, 2)
+	assert.Equal(t, context.Canceled, transport.contexts[0].Err())
+	assert.NoError(t, transport.contexts[1].Err())
+}
+
+func TestPersistedQueryTransport_RejectedAfterData(t *testing.T) {
+	transport := &persistedTransport{calls: [][]*pbgraphql.Response{
+		{{Data: `{"a":1}`}, persistedQueryError("PersistedQueryNotFound", "")},
+		{{Data: `{"a":2}`}},
+	}}
+	persisted := &persistedQueryTransport{transport: transport, acknowledged: map[string]bool{testPersistedDocumentHash: true}}
+
+	stream, err := persisted.Execute(context.Background(), &pbgraphql.Request{Query: testPersistedDocument}, "")
+	require.NoError(t, err)
+
+	response, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, response.Data)
+
+	response, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PersistedQueryNotFound"}, errorMessages(response.Errors))
+
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []string{""}, transport.queries)
+}
+
+func TestPersistedQueryErrorOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected persistedQueryOutcome
+	}{
+		{"no error", nil, persistedQueryAccepted},
+		{"message only in error text", status.Error(codes.Unavailable, "PersistedQueryNotFound"), persistedQueryAccepted},
+		{"http status not found", newHTTPStatusError(http.StatusBadRequest, []byte(`{"errors":[{"message":"PersistedQueryNotFound"}]}`)), persistedQueryNotFound},
+		{"http status not supported by code", newHTTPStatusError(http.StatusBadRequest, []byte(`{"errors":[{"message":"unsupported","extensions":{"code":"PERSISTED_QUERY_NOT_SUPPORTED"}}]}`)), persistedQueryNotSupported},
+		{"http status other errors", newHTTPStatusError(http.StatusBadRequest, []byte(`{"errors":[{"message":"invalid"}]}`)), persistedQueryAccepted},
+		{"http status without graphql body", newHTTPStatusError(http.StatusBadGateway, []byte("PersistedQueryNotFound")), persistedQueryAccepted},
+		{"wrapped graphql errors", fmt.Errorf("wrapped: %w", GraphQLErrors{{Message: "PersistedQueryNotFound"}}), persistedQueryNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, persistedQueryErrorOutcome(test.err))
+		})
+	}
+}
+
+func TestPersistedQueries_Transports(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []ClientOption
+		expectedErr string
+	}{
+		{"grpc", nil, "persisted queries require an HTTP or WebSocket transport"},
+		{"custom", []ClientOption{WithGraphQLTransport(&persistedTransport{})}, "persisted queries require an HTTP or WebSocket transport"},
+		{"http", []ClientOption{WithHTTPTransport("http://localhost:1/graphql")}, ""},
+		{"websocket", []ClientOption{WithWebSocketTransport("ws://localhost:1/graphql", GraphQLTransportWS)}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dfuseClient, err := NewClient("localhost:1", "", append(test.options, WithoutAuthentication(), WithPersistedQueries())...)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			_, persisted := dfuseClient.(*client).queryTransport.(*persistedQueryTransport)
+			assert.True(t, persisted)
+		})
+	}
+}
+
+func TestPersistedQueries_HTTPTransportErrorStatus(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var decoded jsonRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&decoded))
+		queries = append(queries, decoded.Query)
+
+		if decoded.Query == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"not found","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+
+		w.Write([]byte(`{"data":{"ping":"pong"}}`))
+	}))
+	defer server.Close()
+
+	dfuseClient, err := NewClient("localhost:1", "", WithoutAuthentication(), WithHTTPTransport(server.URL), WithPersistedQueries())
+	require.NoError(t, err)
+	dfuseClient.(*client).queryTransport.(*persistedQueryTransport).acknowledged[testPersistedDocumentHash] = true
+
+	response, err := dfuseClient.GraphQLQuery(context.Background(), testPersistedDocument)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ping":"pong"}`, response.Data)
+	assert.Equal(t, []string{"", testPersistedDocument}, queries)
+}
+
+func TestPersistedQueries_HTTPTransport(t *testing.T) {
+	var requests []jsonRequest
+	stored := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var decoded jsonRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&decoded))
+		requests = append(requests, decoded)
+
+		hash := decoded.Extensions.PersistedQuery.SHA256Hash
+		if decoded.Query == "" && !stored[hash] {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+
+		stored[hash] = true
+		w.Write([]byte(`{"data":{"ping":"pong"}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient("localhost:1", "", WithoutAuthentication(), WithHTTPTransport(server.URL), WithPersistedQueries())
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			// Server restarted, the document must be sent again
+			stored = map[string]bool{}
+		}
+
+		response, err := client.GraphQLQuery(context.Background(), testPersistedDocument)
+		require.NoError(t, err)
+		assert.Equal(t, `{"ping":"pong"}`, response.Data)
+	}
+
+	persistedQuery := &jsonExtensions{PersistedQuery: &jsonPersistedQuery{Version: 1, SHA256Hash: testPersistedDocumentHash}}
+	assert.Equal(t, []jsonRequest{
+		{Query: testPersistedDocument, Extensions: persistedQuery},
+		{Extensions: persistedQuery},
+		{Extensions: persistedQuery},
+		{Query: testPersistedDocument, Extensions: persistedQuery},
+	}, requests)
+}
@@ -0,0 +1,115 @@
+package dfuse
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+)
+
+func TestProxyResolver_GRPCDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	pbgraphql.RegisterGraphQLServer(server, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			return stream.Send(&pbgraphql.Response{Data: `{}`})
+		},
+	})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	tunnelled := atomic.NewInt32(0)
+	proxy := httptest.NewServer(testConnectProxy(t, "user", "secret", tunnelled))
+	defer proxy.Close()
+
+	tests := []struct {
+		name              string
+		proxyURL          string
+		expectedErr       string
+		expectedTunnelled int32
+	}{
+		{"authenticated", "http://user:secret@" + proxy.Listener.Addr().String(), "", 1},
+		{"wrong credentials", "http://user:wrong@" + proxy.Listener.Addr().String(), "CONNECT to \"" + listener.Addr().String() + "\" failed (code 407): invalid credentials", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tunnelled.Store(0)
+
+			proxyURL, err := url.Parse(test.proxyURL)
+			require.NoError(t, err)
+
+			// Loopback addresses are never proxied by the environment based resolver, force it
+			resolver := proxyResolver(func(*url.URL) (*url.URL, error) { return proxyURL, nil })
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := resolver.grpcDialer()(ctx, listener.Addr().String())
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				assert.NotContains(t, err.Error(), "wrong", "proxy password must be redacted from errors")
+				return
+			}
+
+			require.NoError(t, err)
+			conn.Close()
+
+			grpcConn, err := grpc.Dial(listener.Addr().String(), plainTextDialOption, grpc.WithContextDialer(resolver.grpcDialer()))
+			require.NoError(t, err)
+			defer grpcConn.Close()
+
+			client, err := NewClient("", "", WithGRPCConn(grpcConn), WithoutAuthentication())
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(ctx, "{ ping }")
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedTunnelled+1, tunnelled.Load())
+		})
+	}
+}
+
+// testConnectProxy is a minimal HTTP CONNECT proxy requiring basic authentication
+func testConnectProxy(t *testing.T, username, password string, tunnelled *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		request := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+		actualUsername, actualPassword, ok := request.BasicAuth()
+		if !ok || actualUsername != username || actualPassword != password {
+			http.Error(w, "invalid credentials", http.StatusProxyAuthRequired)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		tunnelled.Inc()
+		w.WriteHeader(http.StatusOK)
+
+		downstream, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+
+		go func() { io.Copy(upstream, downstream); upstream.Close() }()
+		go func() { io.Copy(downstream, upstream); downstream.Close() }()
+	}
+}
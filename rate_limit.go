@@ -0,0 +1,115 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned (wrapped) by GraphQL calls refused by the client-side rate limiter
+// configured through `WithRateLimit` when `RateLimit.FailFast` is set.
+var ErrRateLimited = errors.New("client-side rate limit exceeded")
+
+// RateLimit defines the client-side token bucket budgets applied to GraphQL calls, a zero
+// rate means the category is not limited.
+type RateLimit struct {
+	// QueriesPerSecond is the sustained rate of `GraphQLQuery` calls, QueryBurst the amount of
+	// calls that can be performed at once (defaults to 1 when QueriesPerSecond is set).
+	QueriesPerSecond float64
+	QueryBurst       int
+
+	// StreamsPerSecond is the sustained rate of `GraphQLSubscription` and `RawGraphQL` stream
+	// opens, StreamBurst the amount of streams that can be opened at once (defaults to 1 when
+	// StreamsPerSecond is set).
+	StreamsPerSecond float64
+	StreamBurst      int
+
+	// FailFast makes calls exceeding the budget fail right away with `ErrRateLimited` instead of
+	// waiting for the budget to be replenished (or for the call's context to be done).
+	FailFast bool
+}
+
+// WithRateLimit is an option to rate limit GraphQL calls on the client side, smoothing bursts
+// that would otherwise be refused by the server with `ResourceExhausted`. By default, a call
+// exceeding the budget waits until it's allowed or until its context is done, in which case
+// the context's error is returned.
+func WithRateLimit(limit RateLimit) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.rateLimit = &limit })
+}
+
+type rateLimiter struct {
+	queries  *rate.Limiter
+	streams  *rate.Limiter
+	failFast bool
+}
+
+func newRateLimiter(limit *RateLimit) *rateLimiter {
+	if limit == nil {
+		return nil
+	}
+
+	return &rateLimiter{
+		queries:  newTokenBucket(limit.QueriesPerSecond, limit.QueryBurst),
+		streams:  newTokenBucket(limit.StreamsPerSecond, limit.StreamBurst),
+		failFast: limit.FailFast,
+	}
+}
+
+func newTokenBucket(perSecond float64, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// acquireQuery waits until a query is allowed by the queries budget, see `acquire`.
+func (l *rateLimiter) acquireQuery(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.acquire(ctx, "query", l.queries)
+}
+
+// acquireStream waits until a stream open is allowed by the streams budget, see `acquire`.
+func (l *rateLimiter) acquireStream(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.acquire(ctx, "stream", l.streams)
+}
+
+// acquire takes a token from `bucket` waiting for it if needed, failing right away with
+// `ErrRateLimited` in fail fast mode. A `nil` bucket means the category is not limited.
+func (l *rateLimiter) acquire(ctx context.Context, kind string, bucket *rate.Limiter) error {
+	if bucket == nil {
+		return nil
+	}
+
+	if l.failFast {
+		if !bucket.Allow() {
+			return fmt.Errorf("%s: %w", kind, ErrRateLimited)
+		}
+
+		return nil
+	}
+
+	if err := bucket.Wait(ctx); err != nil {
+		// Wait fails right away if the context's deadline is before the token is available
+		if ctx.Err() == nil {
+			return fmt.Errorf("%s rate limit wait: %w: %s", kind, context.DeadlineExceeded, err)
+		}
+
+		return fmt.Errorf("%s rate limit wait: %w", kind, ctx.Err())
+	}
+
+	return nil
+}
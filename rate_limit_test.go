@@ -0,0 +1,63 @@
+package dfuse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RateLimit(t *testing.T) {
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			return stream.Send(&pbgraphql.Response{Data: `{}`})
+		},
+	})
+
+	tests := []struct {
+		name        string
+		limit       RateLimit
+		timeout     time.Duration
+		query       bool
+		expectedErr error
+	}{
+		{"query fail fast", RateLimit{QueriesPerSecond: 0.001, FailFast: true}, time.Second, true, ErrRateLimited},
+		{"query wait deadline", RateLimit{QueriesPerSecond: 0.001}, 50 * time.Millisecond, true, context.DeadlineExceeded},
+		{"query unlimited", RateLimit{StreamsPerSecond: 0.001, FailFast: true}, time.Second, true, nil},
+		{"stream fail fast", RateLimit{StreamsPerSecond: 0.001, FailFast: true}, time.Second, false, ErrRateLimited},
+		{"stream unlimited", RateLimit{QueriesPerSecond: 0.001, FailFast: true}, time.Second, false, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithRateLimit(test.limit))
+			require.NoError(t, err)
+
+			call := func(ctx context.Context) error {
+				if test.query {
+					_, err := client.GraphQLQuery(ctx, "{ ping }")
+					return err
+				}
+
+				_, err := client.GraphQLSubscription(ctx, "subscription { ping }")
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+
+			// The first call consumes the burst
+			require.NoError(t, call(ctx))
+
+			err = call(ctx)
+			if test.expectedErr == nil {
+				require.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy defines how `GraphQLQuery` retries transient failures, zero values are replaced
+// by their documented default.
+type RetryPolicy struct {
+	// MaxAttempts is the total amount of attempts, the first one included (defaults to 3).
+	MaxAttempts int
+
+	// InitialBackoff is the wait time before the first retry, doubled on each subsequent retry
+	// (defaults to 100ms).
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait time between two attempts (defaults to 5s).
+	MaxBackoff time.Duration
+
+	// AttemptTimeout bounds the duration of each attempt, an attempt timing out is retried as
+	// long as the call's context is not done. No timeout other than the call's context is
+	// applied when zero.
+	AttemptTimeout time.Duration
+}
+
+// WithQueryRetry is an option to retry `GraphQLQuery` calls failing with a transient error, using
+// the same classification as subscriptions' automatic reconnection (`Unavailable`, `Internal`,
+// `ResourceExhausted`, etc.). Errors returned by queries are then `*RetryError` reporting the
+// amount of attempts performed.
+//
+// Each attempt goes through the rate limiter (`WithRateLimit`) and circuit breaker
+// (`WithCircuitBreaker`), retries stop as soon as the circuit opens.
+func WithQueryRetry(policy RetryPolicy) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.queryRetry = &policy })
+}
+
+// RetryError is returned by `GraphQLQuery` when the client has a retry policy, see `WithQueryRetry`.
+type RetryError struct {
+	// Attempts is the amount of attempts performed, the first one included.
+	Attempts int
+
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempt(s): %s", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func newRetryPolicy(policy *RetryPolicy) *RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+
+	resolved := *policy
+	if resolved.MaxAttempts <= 0 {
+		resolved.MaxAttempts = 3
+	}
+
+	if resolved.InitialBackoff <= 0 {
+		resolved.InitialBackoff = 100 * time.Millisecond
+	}
+
+	if resolved.MaxBackoff <= 0 {
+		resolved.MaxBackoff = 5 * time.Second
+	}
+
+	return &resolved
+}
+
+func (p *RetryPolicy) nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return next
+}
+
+// isRetryableQueryError returns whether a query attempt that failed with `err` should be retried.
+// Only gRPC errors are considered, errors raised on the client side (authentication, rate limiting,
+// open circuit) are returned right away.
+func (c *client) isRetryableQueryError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return false
+	}
+
+	return isTransientError(grpcErr.GRPCStatus().Err(), c.logger)
+}
@@ -0,0 +1,76 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient_QueryRetry(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         []error
+		policy           RetryPolicy
+		expectedAttempts int
+		expectedCode     codes.Code
+	}{
+		{"success first attempt", nil, RetryPolicy{}, 1, codes.OK},
+		{"transient then success", []error{status.Error(codes.Unavailable, "down"), status.Error(codes.Internal, "oops")}, RetryPolicy{}, 3, codes.OK},
+		{"transient exhausts attempts", []error{status.Error(codes.Unavailable, "down"), status.Error(codes.Unavailable, "down")}, RetryPolicy{MaxAttempts: 2}, 2, codes.Unavailable},
+		{"permanent not retried", []error{status.Error(codes.InvalidArgument, "bad query")}, RetryPolicy{}, 1, codes.InvalidArgument},
+		{"attempt timeout retried", []error{errAttemptHangs}, RetryPolicy{AttemptTimeout: 50 * time.Millisecond}, 2, codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			executions := atomic.NewInt32(0)
+			conn := newTestGRPCConn(t, &testGraphQLServer{
+				execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+					execution := int(executions.Inc()) - 1
+					if execution < len(test.failures) {
+						if test.failures[execution] == errAttemptHangs {
+							<-stream.Context().Done()
+							return stream.Context().Err()
+						}
+
+						return test.failures[execution]
+					}
+
+					return stream.Send(&pbgraphql.Response{Data: `{}`})
+				},
+			})
+
+			policy := test.policy
+			policy.InitialBackoff = time.Millisecond
+			client, err := NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithQueryRetry(policy))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			response, err := client.GraphQLQuery(ctx, "{ ping }")
+			assert.Equal(t, int32(test.expectedAttempts), executions.Load())
+
+			if test.expectedCode == codes.OK {
+				require.NoError(t, err)
+				assert.Equal(t, `{}`, response.Data)
+				return
+			}
+
+			var retryErr *RetryError
+			require.True(t, errors.As(err, &retryErr), "expected a *RetryError, got %T", err)
+			assert.Equal(t, test.expectedAttempts, retryErr.Attempts)
+			assert.Equal(t, test.expectedCode, grpcCode(err))
+		})
+	}
+}
+
+var errAttemptHangs = errors.New("attempt hangs until canceled")
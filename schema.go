@@ -0,0 +1,518 @@
+package dfuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+	"go.uber.org/zap"
+)
+
+// DefaultSchemaCacheTTL is the duration after which a schema cached on disk is introspected
+// again from the endpoint, see `WithSchemaCache`.
+const DefaultSchemaCacheTTL = 24 * time.Hour
+
+// IntrospectionQuery is the standard GraphQL introspection query used by `Client.GraphQLSchema`.
+const IntrospectionQuery = `
+query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType { kind name }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+// GraphQLSchema is the schema of a GraphQL endpoint, as introspected by `Client.GraphQLSchema`.
+// The embedded `ast.Schema` is the parsed model of the schema (types, fields, directives) usable
+// to validate documents and generate code.
+type GraphQLSchema struct {
+	*ast.Schema
+
+	// FetchedAt is the moment the schema was introspected from the endpoint.
+	FetchedAt time.Time
+
+	introspection json.RawMessage
+	sdl           string
+}
+
+// NewGraphQLSchema creates a schema out of the `data` of an introspection query response (see
+// `IntrospectionQuery`), the JSON object holding the `__schema` field.
+func NewGraphQLSchema(introspection []byte) (*GraphQLSchema, error) {
+	var data struct {
+		Schema *introspectionSchema `json:"__schema"`
+	}
+
+	if err := json.Unmarshal(introspection, &data); err != nil {
+		return nil, fmt.Errorf("decode introspection: %w", err)
+	}
+
+	if data.Schema == nil {
+		return nil, fmt.Errorf("decode introspection: no __schema field")
+	}
+
+	document, err := parser.ParseSchema(&ast.Source{Name: "introspection", Input: data.Schema.sdl()})
+	if err != nil {
+		return nil, fmt.Errorf("parse introspected schema: %w", err)
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	formatter.NewFormatter(buffer, formatter.WithIndent("  ")).FormatSchemaDocument(document)
+	sdl := buffer.String()
+
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: sdl})
+	if err != nil {
+		return nil, fmt.Errorf("load introspected schema: %w", err)
+	}
+
+	return &GraphQLSchema{Schema: schema, introspection: json.RawMessage(introspection), sdl: sdl}, nil
+}
+
+// NewGraphQLSchemaFromSDL creates a schema out of its definition in GraphQL Schema Definition
+// Language, like the output of `GraphQLSchema.SDL`.
+func NewGraphQLSchemaFromSDL(sdl string) (*GraphQLSchema, error) {
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: sdl})
+	if err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+
+	return &GraphQLSchema{Schema: schema, sdl: sdl}, nil
+}
+
+// SDL returns the schema in GraphQL Schema Definition Language, built-in scalars, directives
+// and introspection types excluded.
+func (s *GraphQLSchema) SDL() string {
+	return s.sdl
+}
+
+// WithSchemaCache is an option to cache the schema introspected by `Client.GraphQLSchema` in
+// `dir`, one file per endpoint, the cached schema being introspected again once older than
+// `ttl` (never when zero). An empty `dir` disables on-disk caching, the schema is then only
+// cached in memory for the lifetime of the client.
+//
+// Defaults to `~/.dfuse/schemas` (next to the API token store) and `DefaultSchemaCacheTTL`.
+func WithSchemaCache(dir string, ttl time.Duration) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) {
+		o.schemaCacheDir = &dir
+		o.schemaCacheTTL = ttl
+	})
+}
+
+func defaultSchemaCacheDir() string {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		zlog.Debug("unable to determine home directory, schema on-disk cache disabled", zap.Error(err))
+		return ""
+	}
+
+	return filepath.Join(homedir, ".dfuse", "schemas")
+}
+
+func (c *client) GraphQLSchema(ctx context.Context) (*GraphQLSchema, error) {
+	c.schemaLock.Lock()
+	defer c.schemaLock.Unlock()
+
+	if c.schema != nil && !c.schemaExpired(c.schema) {
+		return c.schema, nil
+	}
+
+	cacheFile := c.schemaCacheFile()
+	if cacheFile != "" {
+		schema, err := readSchemaCache(cacheFile)
+		if err != nil {
+			c.logger.Warn("unable to read schema cache, introspecting endpoint", zap.String("file", cacheFile), zap.Error(err))
+		} else if schema != nil && !c.schemaExpired(schema) {
+			c.logger.Debug("graphql schema read from cache", zap.String("file", cacheFile), zap.Time("fetched_at", schema.FetchedAt))
+			c.schema = schema
+			return schema, nil
+		}
+	}
+
+	response, err := c.introspect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("introspect schema: %w", err)
+	}
+
+	schema, err := NewGraphQLSchema([]byte(response.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	schema.FetchedAt = time.Now()
+	if cacheFile != "" {
+		if err := writeSchemaCache(cacheFile, c.schemaEndpoint, schema); err != nil {
+			c.logger.Warn("unable to write schema cache", zap.String("file", cacheFile), zap.Error(err))
+		}
+	}
+
+	c.schema = schema
+	return schema, nil
+}
+
+// introspect sends `IntrospectionQuery` straight through the transport. It bypasses the rate
+// limiter, circuit breaker, retries and metrics of queries since it's performed on behalf of
+// another call, validated against the schema, which already went through them.
+func (c *client) introspect(ctx context.Context) (*pbgraphql.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	call, err := c.prepareCall(ctx, "query", IntrospectionQuery, []GraphQLOption{skipValidation})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := call.stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("query failed (request id %s): %w", call.requestID, err)
+	}
+
+	return ErrorPolicyFail.apply(response)
+}
+
+func (c *client) schemaExpired(schema *GraphQLSchema) bool {
+	return c.schemaCacheTTL > 0 && time.Since(schema.FetchedAt) > c.schemaCacheTTL
+}
+
+// schemaCacheFile returns the file caching the schema of the client's endpoint, empty when the
+// on-disk cache is disabled or the endpoint is unknown (custom transport without network).
+func (c *client) schemaCacheFile() string {
+	if c.schemaCacheDir == "" || c.schemaEndpoint == "" {
+		return ""
+	}
+
+	return filepath.Join(c.schemaCacheDir, shasum256StringToHex(c.schemaEndpoint)+".json")
+}
+
+// schemaCache represents the on-disk serialization format of a cached schema
+type schemaCache struct {
+	Endpoint      string          `json:"endpoint"`
+	FetchedAt     unixTimestamp   `json:"fetched_at"`
+	Introspection json.RawMessage `json:"introspection"`
+}
+
+func readSchemaCache(filename string) (*GraphQLSchema, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var cached schemaCache
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, fmt.Errorf("decode schema cache: %w", err)
+	}
+
+	schema, err := NewGraphQLSchema(cached.Introspection)
+	if err != nil {
+		return nil, err
+	}
+
+	schema.FetchedAt = time.Time(cached.FetchedAt)
+	return schema, nil
+}
+
+func writeSchemaCache(filename string, endpoint string, schema *GraphQLSchema) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return fmt.Errorf("create all directories %q: %w", filepath.Dir(filename), err)
+	}
+
+	content, err := json.Marshal(schemaCache{Endpoint: endpoint, FetchedAt: unixTimestamp(schema.FetchedAt), Introspection: schema.introspection})
+	if err != nil {
+		return fmt.Errorf("encode schema cache: %w", err)
+	}
+
+	return ioutil.WriteFile(filename, content, 0644)
+}
+
+type introspectionSchema struct {
+	QueryType        *introspectionTypeRef     `json:"queryType"`
+	MutationType     *introspectionTypeRef     `json:"mutationType"`
+	SubscriptionType *introspectionTypeRef     `json:"subscriptionType"`
+	Types            []*introspectionType      `json:"types"`
+	Directives       []*introspectionDirective `json:"directives"`
+}
+
+type introspectionType struct {
+	Kind          string                     `json:"kind"`
+	Name          string                     `json:"name"`
+	Description   string                     `json:"description"`
+	Fields        []*introspectionField      `json:"fields"`
+	InputFields   []*introspectionInputValue `json:"inputFields"`
+	Interfaces    []*introspectionTypeRef    `json:"interfaces"`
+	EnumValues    []*introspectionEnumValue  `json:"enumValues"`
+	PossibleTypes []*introspectionTypeRef    `json:"possibleTypes"`
+}
+
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+type introspectionField struct {
+	Name              string                     `json:"name"`
+	Description       string                     `json:"description"`
+	Args              []*introspectionInputValue `json:"args"`
+	Type              *introspectionTypeRef      `json:"type"`
+	IsDeprecated      bool                       `json:"isDeprecated"`
+	DeprecationReason *string                    `json:"deprecationReason"`
+}
+
+type introspectionInputValue struct {
+	Name         string                `json:"name"`
+	Description  string                `json:"description"`
+	Type         *introspectionTypeRef `json:"type"`
+	DefaultValue *string               `json:"defaultValue"`
+}
+
+type introspectionEnumValue struct {
+	Name              string  `json:"name"`
+	Description       string  `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type introspectionDirective struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Locations   []string                   `json:"locations"`
+	Args        []*introspectionInputValue `json:"args"`
+}
+
+// builtinDirectives are defined by the GraphQL specification, they are part of every schema
+var builtinDirectives = map[string]bool{"skip": true, "include": true, "deprecated": true, "specifiedBy": true}
+
+// builtinScalars are defined by the GraphQL specification, they are part of every schema
+var builtinScalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true}
+
+// sdl returns the introspected schema in GraphQL Schema Definition Language, unformatted.
+func (s *introspectionSchema) sdl() string {
+	out := &strings.Builder{}
+
+	out.WriteString("schema {\n")
+	for _, root := range []struct {
+		operation string
+		ref       *introspectionTypeRef
+	}{{"query", s.QueryType}, {"mutation", s.MutationType}, {"subscription", s.SubscriptionType}} {
+		if root.ref != nil {
+			fmt.Fprintf(out, "  %s: %s\n", root.operation, root.ref.Name)
+		}
+	}
+	out.WriteString("}\n")
+
+	for _, directive := range s.Directives {
+		if builtinDirectives[directive.Name] {
+			continue
+		}
+
+		writeDescription(out, directive.Description)
+		fmt.Fprintf(out, "directive @%s%s on %s\n", directive.Name, argumentsSDL(directive.Args), strings.Join(directive.Locations, " | "))
+	}
+
+	types := append([]*introspectionType(nil), s.Types...)
+	sort.SliceStable(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+
+	for _, definition := range types {
+		if strings.HasPrefix(definition.Name, "__") || builtinScalars[definition.Name] {
+			continue
+		}
+
+		writeDescription(out, definition.Description)
+		switch definition.Kind {
+		case "SCALAR":
+			fmt.Fprintf(out, "scalar %s\n", definition.Name)
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if definition.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+
+			fmt.Fprintf(out, "%s %s", keyword, definition.Name)
+			if len(definition.Interfaces) > 0 {
+				names := make([]string, len(definition.Interfaces))
+				for i, ref := range definition.Interfaces {
+					names[i] = ref.Name
+				}
+
+				fmt.Fprintf(out, " implements %s", strings.Join(names, " & "))
+			}
+
+			out.WriteString(" {\n")
+			for _, field := range definition.Fields {
+				writeDescription(out, field.Description)
+				fmt.Fprintf(out, "  %s%s: %s%s\n", field.Name, argumentsSDL(field.Args), field.Type, deprecatedSDL(field.IsDeprecated, field.DeprecationReason))
+			}
+			out.WriteString("}\n")
+		case "UNION":
+			names := make([]string, len(definition.PossibleTypes))
+			for i, ref := range definition.PossibleTypes {
+				names[i] = ref.Name
+			}
+
+			fmt.Fprintf(out, "union %s = %s\n", definition.Name, strings.Join(names, " | "))
+		case "ENUM":
+			fmt.Fprintf(out, "enum %s {\n", definition.Name)
+			for _, value := range definition.EnumValues {
+				writeDescription(out, value.Description)
+				fmt.Fprintf(out, "  %s%s\n", value.Name, deprecatedSDL(value.IsDeprecated, value.DeprecationReason))
+			}
+			out.WriteString("}\n")
+		case "INPUT_OBJECT":
+			fmt.Fprintf(out, "input %s {\n", definition.Name)
+			for _, field := range definition.InputFields {
+				writeDescription(out, field.Description)
+				fmt.Fprintf(out, "  %s\n", inputValueSDL(field))
+			}
+			out.WriteString("}\n")
+		}
+	}
+
+	return out.String()
+}
+
+func (r *introspectionTypeRef) String() string {
+	switch r.Kind {
+	case "NON_NULL":
+		return r.OfType.String() + "!"
+	case "LIST":
+		return "[" + r.OfType.String() + "]"
+	default:
+		return r.Name
+	}
+}
+
+func argumentsSDL(args []*introspectionInputValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = inputValueSDL(arg)
+		if arg.Description != "" {
+			values[i] = quoteGraphQLString(arg.Description) + " " + values[i]
+		}
+	}
+
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func inputValueSDL(value *introspectionInputValue) string {
+	out := value.Name + ": " + value.Type.String()
+	if value.DefaultValue != nil {
+		out += " = " + *value.DefaultValue
+	}
+
+	return out
+}
+
+func deprecatedSDL(deprecated bool, reason *string) string {
+	if !deprecated {
+		return ""
+	}
+
+	if reason == nil {
+		return " @deprecated"
+	}
+
+	return " @deprecated(reason: " + quoteGraphQLString(*reason) + ")"
+}
+
+func writeDescription(out *strings.Builder, description string) {
+	if description != "" {
+		out.WriteString(quoteGraphQLString(description) + "\n")
+	}
+}
+
+// quoteGraphQLString returns `in` as a GraphQL string literal, JSON string escaping being a
+// subset of GraphQL's.
+func quoteGraphQLString(in string) string {
+	buffer := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(in)
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
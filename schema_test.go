@@ -0,0 +1,211 @@
+package dfuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const testIntrospection = `{"__schema": {
+	"queryType": {"name": "Query"},
+	"mutationType": null,
+	"subscriptionType": {"name": "Subscription"},
+	"directives": [
+		{"name": "include", "locations": ["FIELD"], "args": [{"name": "if", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "Boolean"}}}]},
+		{"name": "live", "description": "Streams updates.", "locations": ["QUERY", "FIELD"], "args": []}
+	],
+	"types": [
+		{"kind": "SCALAR", "name": "String"},
+		{"kind": "SCALAR", "name": "Int"},
+		{"kind": "SCALAR", "name": "Boolean"},
+		{"kind": "SCALAR", "name": "Uint32"},
+		{"kind": "SCALAR", "name": "Uint64", "description": "Unsigned 64 bits integer, as a string."},
+		{"kind": "OBJECT", "name": "__Schema", "fields": [{"name": "description", "args": [], "type": {"kind": "SCALAR", "name": "String"}}]},
+		{"kind": "OBJECT", "name": "Query", "fields": [
+			{"name": "block", "args": [{"name": "num", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "Uint32"}}}], "type": {"kind": "OBJECT", "name": "Block"}},
+			{"name": "blocks", "args": [{"name": "limit", "description": "Maximum count", "type": {"kind": "SCALAR", "name": "Int"}, "defaultValue": "10"}], "type": {"kind": "NON_NULL", "ofType": {"kind": "LIST", "ofType": {"kind": "NON_NULL", "ofType": {"kind": "OBJECT", "name": "Block"}}}}},
+			{"name": "oldBlock", "args": [], "type": {"kind": "OBJECT", "name": "Block"}, "isDeprecated": true, "deprecationReason": "Use \"block\""}
+		], "interfaces": []},
+		{"kind": "OBJECT", "name": "Subscription", "fields": [
+			{"name": "transfers", "args": [{"name": "filter", "type": {"kind": "INPUT_OBJECT", "name": "TransferFilter"}}], "type": {"kind": "UNION", "name": "Transfer"}}
+		], "interfaces": []},
+		{"kind": "INTERFACE", "name": "Node", "fields": [{"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}}], "possibleTypes": [{"kind": "OBJECT", "name": "Block"}]},
+		{"kind": "OBJECT", "name": "Block", "description": "A block of the chain.", "fields": [
+			{"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}},
+			{"name": "number", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "Uint64"}}},
+			{"name": "status", "args": [], "type": {"kind": "ENUM", "name": "BlockStatus"}}
+		], "interfaces": [{"kind": "INTERFACE", "name": "Node"}]},
+		{"kind": "ENUM", "name": "BlockStatus", "enumValues": [
+			{"name": "IRREVERSIBLE"},
+			{"name": "PENDING", "isDeprecated": true, "deprecationReason": null}
+		]},
+		{"kind": "OBJECT", "name": "TokenTransfer", "fields": [{"name": "amount", "args": [], "type": {"kind": "SCALAR", "name": "String"}}], "interfaces": []},
+		{"kind": "OBJECT", "name": "NativeTransfer", "fields": [{"name": "value", "args": [], "type": {"kind": "SCALAR", "name": "String"}}], "interfaces": []},
+		{"kind": "UNION", "name": "Transfer", "possibleTypes": [{"kind": "OBJECT", "name": "TokenTransfer"}, {"kind": "OBJECT", "name": "NativeTransfer"}]},
+		{"kind": "INPUT_OBJECT", "name": "TransferFilter", "inputFields": [
+			{"name": "from", "type": {"kind": "LIST", "ofType": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "String"}}}},
+			{"name": "minimum", "type": {"kind": "SCALAR", "name": "Int"}, "defaultValue": "0"}
+		]}
+	]
+}}`
+
+const testSchemaSDL = `schema {
+  query: Query
+  subscription: Subscription
+}
+"""Streams updates."""
+directive @live on QUERY | FIELD
+"""A block of the chain."""
+type Block implements Node {
+  id: String!
+  number: Uint64!
+  status: BlockStatus
+}
+enum BlockStatus {
+  IRREVERSIBLE
+  PENDING @deprecated
+}
+type NativeTransfer {
+  value: String
+}
+interface Node {
+  id: String!
+}
+type Query {
+  block(num: Uint32!): Block
+  blocks(
+    """Maximum count"""
+    limit: Int = 10
+  ): [Block!]!
+  oldBlock: Block @deprecated(reason: "Use \"block\"")
+}
+type Subscription {
+  transfers(filter: TransferFilter): Transfer
+}
+type TokenTransfer {
+  amount: String
+}
+union Transfer = TokenTransfer | NativeTransfer
+input TransferFilter {
+  from: [String!]
+  minimum: Int = 0
+}
+scalar Uint32
+"""Unsigned 64 bits integer, as a string."""
+scalar Uint64
+`
+
+func TestNewGraphQLSchema(t *testing.T) {
+	schema, err := NewGraphQLSchema([]byte(testIntrospection))
+	require.NoError(t, err)
+
+	assert.Equal(t, testSchemaSDL, schema.SDL())
+	assert.Equal(t, "Query", schema.Query.Name)
+	assert.Equal(t, "Subscription", schema.Subscription.Name)
+	assert.Nil(t, schema.Mutation)
+	assert.Equal(t, "[Block!]!", schema.Types["Query"].Fields.ForName("blocks").Type.String())
+	assert.Equal(t, []string{"Block"}, typeNames(schema.GetPossibleTypes(schema.Types["Node"])))
+	assert.Equal(t, []string{"TokenTransfer", "NativeTransfer"}, typeNames(schema.GetPossibleTypes(schema.Types["Transfer"])))
+
+	_, err = NewGraphQLSchema([]byte(`{"data": {}}`))
+	assert.EqualError(t, err, "decode introspection: no __schema field")
+}
+
+func TestClient_GraphQLSchema(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, shasum256StringToHex("localhost:9000")+".json")
+
+	tests := []struct {
+		name          string
+		cached        string
+		ttl           time.Duration
+		expectedFetch bool
+	}{
+		{"not cached", "", time.Hour, true},
+		{"cached", `{"endpoint":"localhost:9000","fetched_at":` + unixNow(-time.Minute) + `,"introspection":` + testIntrospection + `}`, time.Hour, false},
+		{"cached expired", `{"endpoint":"localhost:9000","fetched_at":` + unixNow(-2*time.Hour) + `,"introspection":` + testIntrospection + `}`, time.Hour, true},
+		{"cached without expiration", `{"endpoint":"localhost:9000","fetched_at":` + unixNow(-48*time.Hour) + `,"introspection":` + testIntrospection + `}`, 0, false},
+		{"cache corrupted", `{"endpoint":`, time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(cacheFile)
+			if test.cached != "" {
+				require.NoError(t, ioutil.WriteFile(cacheFile, []byte(test.cached), 0644))
+			}
+
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: testIntrospection}}}
+			client, err := NewClient("localhost:9000", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithSchemaCache(dir, test.ttl))
+			require.NoError(t, err)
+
+			schema, err := client.GraphQLSchema(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, testSchemaSDL, schema.SDL())
+
+			if test.expectedFetch {
+				require.NotNil(t, transport.request)
+				assert.Equal(t, IntrospectionQuery, transport.request.Query)
+
+				cached, err := readSchemaCache(cacheFile)
+				require.NoError(t, err)
+				require.NotNil(t, cached)
+				assert.Equal(t, testSchemaSDL, cached.SDL())
+				assert.WithinDuration(t, time.Now(), cached.FetchedAt, 2*time.Second)
+			} else {
+				assert.Nil(t, transport.request)
+			}
+
+			// Second call served from memory
+			transport.request = nil
+			again, err := client.GraphQLSchema(context.Background())
+			require.NoError(t, err)
+			assert.Same(t, schema, again)
+			assert.Nil(t, transport.request)
+		})
+	}
+}
+
+func TestClient_GraphQLSchema_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    *pbgraphql.Response
+		expectedErr string
+	}{
+		{"graphql errors", &pbgraphql.Response{Errors: []*pbgraphql.Error{{Message: "introspection disabled"}}}, "introspect schema: graphql errors: introspection disabled"},
+		{"invalid introspection", &pbgraphql.Response{Data: `{"__schema": 1}`}, "decode introspection: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{test.response}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithSchemaCache("", 0))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLSchema(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedErr)
+		})
+	}
+}
+
+func typeNames(definitions []*ast.Definition) (out []string) {
+	for _, definition := range definitions {
+		out = append(out, definition.Name)
+	}
+
+	return
+}
+
+func unixNow(offset time.Duration) string {
+	return strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+}
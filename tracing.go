@@ -0,0 +1,73 @@
+package dfuse
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const tracerName = "github.com/streamingfast/client-go"
+
+// traceContextPropagator propagates the active span to the server using W3C Trace Context headers.
+var traceContextPropagator = propagation.TraceContext{}
+
+// WithTracerProvider is an option to trace client operations (API token retrieval and
+// issuance, queries, subscription connection attempts and reconnections) using OpenTelemetry.
+// The trace context is propagated to the dfuse endpoint (in gRPC metadata) and to the
+// authentication server (in HTTP headers) using the W3C Trace Context format.
+//
+// Tracing is disabled when this option is not used.
+func WithTracerProvider(provider trace.TracerProvider) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.tracerProvider = provider })
+}
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = trace.NewNoopTracerProvider()
+	}
+
+	return provider.Tracer(tracerName)
+}
+
+func (c *client) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends `span`, flagging it as failed with `err` when it's not nil nor `io.EOF`.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != io.EOF {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// metadataCarrier adapts gRPC metadata to OpenTelemetry's `propagation.TextMapCarrier`.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	out := make([]string, 0, len(c))
+	for key := range c {
+		out = append(out, key)
+	}
+
+	return out
+}
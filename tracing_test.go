@@ -0,0 +1,254 @@
+package dfuse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient_Tracing(t *testing.T) {
+	var authTraceParent string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authTraceParent = r.Header.Get("traceparent")
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": "a.b.c", "expires_at": time.Now().Add(time.Hour).Unix()})
+	}))
+	defer authServer.Close()
+
+	var grpcTraceParent string
+	conn := newTestGRPCConn(t, &testGraphQLServer{
+		execute: func(request *pbgraphql.Request, stream pbgraphql.GraphQL_ExecuteServer) error {
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if values := md.Get("traceparent"); len(values) > 0 {
+				grpcTraceParent = values[0]
+			}
+
+			return stream.Send(&pbgraphql.Response{Data: `{}`})
+		},
+	})
+
+	provider := &recordingTracerProvider{}
+	client, err := NewClient("", "key", WithGRPCConn(conn), WithAuthURL(authServer.URL), WithAPITokenStore(NewInMemoryAPITokenStore()), WithTracerProvider(provider))
+	require.NoError(t, err)
+
+	_, err = client.GetAPITokenInfo(context.Background())
+	require.NoError(t, err)
+
+	_, err = client.GetAPITokenInfo(context.Background())
+	require.NoError(t, err)
+
+	// Per RPC credentials cannot be sent over the plain-text test connection, queries are traced unauthenticated
+	client, err = NewClient("", "", WithGRPCConn(conn), WithoutAuthentication(), WithTracerProvider(provider))
+	require.NoError(t, err)
+
+	_, err = client.GraphQLQuery(context.Background(), "{ ping }")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"dfuse.fetchToken",
+		"dfuse.GetAPITokenInfo",
+		"dfuse.GetAPITokenInfo",
+		"dfuse.GraphQLQuery",
+	}, provider.endedSpanNames())
+
+	assert.Equal(t, attribute.BoolValue(false), provider.spans[1].attributes["dfuse.token.cache_hit"])
+	assert.Equal(t, attribute.BoolValue(true), provider.spans[2].attributes["dfuse.token.cache_hit"])
+	assert.Equal(t, provider.spans[1].SpanContext().TraceID(), provider.spans[0].SpanContext().TraceID())
+
+	// Trace context of the auth request is the `fetchToken` span, the gRPC one is the `GraphQLQuery` span
+	assert.Equal(t, traceParent(provider.spans[0].SpanContext()), authTraceParent)
+	assert.Equal(t, traceParent(provider.spans[3].SpanContext()), grpcTraceParent)
+}
+
+func TestClient_Tracing_SubscriptionReconnect(t *testing.T) {
+	transport := &scriptedTransport{steps: []scriptedStep{
+		{response: &pbgraphql.Response{Data: `{"a":1}`}},
+		{err: status.Error(grpccodes.Unavailable, "down")},
+		{err: status.Error(grpccodes.Unavailable, "still down")},
+		{err: status.Error(grpccodes.Unavailable, "still down")},
+		{response: &pbgraphql.Response{Data: `{"a":2}`}},
+	}}
+
+	provider := &recordingTracerProvider{}
+	client, err := NewClient("", "", WithGraphQLTransport(transport), WithoutAuthentication(), WithTracerProvider(provider))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLSubscription(context.Background(), "subscription { a }")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"a":1}`, `{"a":2}`}, receiveAll(t, stream))
+
+	assert.Equal(t, []string{
+		"dfuse.GraphQLSubscription.connect",
+		"dfuse.GraphQLSubscription.reconnect",
+	}, provider.endedSpanNames())
+	assert.Equal(t, attribute.IntValue(3), provider.spans[1].attributes["dfuse.reconnect.attempts"])
+	assert.Len(t, provider.spans[1].events, 2)
+
+	// The initial stream then one per reconnection attempt
+	assert.Equal(t, 4, transport.executions)
+}
+
+func TestClient_Tracing_SubscriptionReconnectEventsCapped(t *testing.T) {
+	defer func(initial, max time.Duration) {
+		subscriptionReconnectInitialBackoff, subscriptionReconnectMaxBackoff = initial, max
+	}(subscriptionReconnectInitialBackoff, subscriptionReconnectMaxBackoff)
+	subscriptionReconnectInitialBackoff, subscriptionReconnectMaxBackoff = time.Millisecond, time.Millisecond
+
+	steps := []scriptedStep{{response: &pbgraphql.Response{Data: `{"a":1}`}}}
+	for i := 0; i < 2*maxReconnectSpanEvents; i++ {
+		steps = append(steps, scriptedStep{err: status.Error(grpccodes.Unavailable, "down")})
+	}
+	transport := &scriptedTransport{steps: append(steps, scriptedStep{response: &pbgraphql.Response{Data: `{"a":2}`}})}
+
+	provider := &recordingTracerProvider{}
+	client, err := NewClient("", "", WithGraphQLTransport(transport), WithoutAuthentication(), WithTracerProvider(provider))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLSubscription(context.Background(), "subscription { a }")
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"a":1}`, `{"a":2}`}, receiveAll(t, stream))
+
+	require.Len(t, provider.spans, 2)
+	assert.Equal(t, attribute.IntValue(2*maxReconnectSpanEvents), provider.spans[1].attributes["dfuse.reconnect.attempts"])
+	assert.Len(t, provider.spans[1].events, maxReconnectSpanEvents)
+	assert.Equal(t, 2*maxReconnectSpanEvents+1, transport.executions)
+}
+
+func traceParent(spanContext trace.SpanContext) string {
+	return "00-" + spanContext.TraceID().String() + "-" + spanContext.SpanID().String() + "-01"
+}
+
+// recordingTracerProvider records all spans started through it, in the order they are ended
+type recordingTracerProvider struct {
+	lock  sync.Mutex
+	spans []*recordedSpan
+}
+
+func (p *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{p}
+}
+
+func (p *recordingTracerProvider) endedSpanNames() (out []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, span := range p.spans {
+		out = append(out, span.name)
+	}
+
+	return
+}
+
+type recordingTracer struct {
+	provider *recordingTracerProvider
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() {
+		traceID = parent.TraceID()
+	}
+
+	span := &recordedSpan{
+		Span:       trace.SpanFromContext(context.Background()),
+		provider:   t.provider,
+		name:       name,
+		attributes: map[attribute.Key]attribute.Value{},
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+	span.SetAttributes(config.Attributes()...)
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordedSpan struct {
+	trace.Span
+
+	provider    *recordingTracerProvider
+	name        string
+	attributes  map[attribute.Key]attribute.Value
+	events      []string
+	status      codes.Code
+	spanContext trace.SpanContext
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext { return s.spanContext }
+func (s *recordedSpan) IsRecording() bool              { return true }
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *recordedSpan) AddEvent(name string, _ ...trace.EventOption) {
+	s.events = append(s.events, name)
+}
+
+func (s *recordedSpan) SetAttributes(attributes ...attribute.KeyValue) {
+	for _, attribute := range attributes {
+		s.attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.provider.lock.Lock()
+	defer s.provider.lock.Unlock()
+
+	s.provider.spans = append(s.provider.spans, s)
+}
+
+// scriptedStep is a response or an error returned by a `scriptedTransport` stream
+type scriptedStep struct {
+	response *pbgraphql.Response
+	err      error
+}
+
+// scriptedTransport returns streams yielding `steps` in order, a stream re-opened after an
+// error resuming where the previous one stopped, then io.EOF
+type scriptedTransport struct {
+	steps      []scriptedStep
+	executions int
+}
+
+func (t *scriptedTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	t.executions++
+	return &scriptedStream{transportStream: transportStream{ctx: ctx}, transport: t}, nil
+}
+
+type scriptedStream struct {
+	transportStream
+	transport *scriptedTransport
+}
+
+func (s *scriptedStream) Recv() (*pbgraphql.Response, error) {
+	if len(s.transport.steps) == 0 {
+		return nil, io.EOF
+	}
+
+	step := s.transport.steps[0]
+	s.transport.steps = s.transport.steps[1:]
+
+	return step.response, step.err
+}
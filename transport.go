@@ -0,0 +1,248 @@
+package dfuse
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// GraphQLTransport executes GraphQL requests against an endpoint, the client uses gRPC by
+// default, see `WithHTTPTransport`, `WithWebSocketTransport` and `WithGraphQLTransport` for
+// the alternatives.
+type GraphQLTransport interface {
+	// Execute sends `request` and returns the stream of its responses. The metadata to send
+	// along the request (i.e. headers) is found in `ctx` (see `metadata.FromOutgoingContext`) and
+	// `token` is the API token to authenticate with, empty if the client is unauthenticated.
+	//
+	// Errors, returned either by `Execute` or by the stream, should be gRPC status errors so
+	// they are classified (transient or permanent) like the ones of the gRPC transport.
+	Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error)
+}
+
+// WithGraphQLTransport is an option to execute all GraphQL calls (queries and subscriptions)
+// through `transport` instead of gRPC, useful to plug mocks or proprietary protocols. The client
+// does not own the transport.
+//
+// When this option is used, the `network` argument of `NewClient` can be empty, it's then used
+// only to resolve the auth URL of a registered network.
+func WithGraphQLTransport(transport GraphQLTransport) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.graphqlTransport = transport })
+}
+
+// WithHTTPTransport is an option to execute GraphQL queries over HTTP POST requests sent to
+// `endpointURL` (like `https://mainnet.eos.dfuse.io/graphql`) instead of gRPC. Subscriptions are
+// not possible over HTTP, they keep using gRPC unless `WithWebSocketTransport` is used too.
+//
+// The client's metadata is sent as HTTP headers and the API token as an `Authorization: Bearer`
+// header. HTTP errors are mapped to their gRPC code equivalent (`503` to `Unavailable`, `429` to
+// `ResourceExhausted`, etc.).
+func WithHTTPTransport(endpointURL string) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) { o.httpTransportURL = endpointURL })
+}
+
+// grpcTransport executes requests over the client's gRPC connection, or over its hedge
+// connection (see `WithHedgeEndpoint`) when `hedge` is set.
+type grpcTransport struct {
+	client *client
+	hedge  bool
+}
+
+func (t *grpcTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	getGraphqlClient := t.client.getGraphqlClient
+	if t.hedge {
+		getGraphqlClient = t.client.getHedgeGraphqlClient
+	}
+
+	graphql, err := getGraphqlClient()
+	if err != nil {
+		return nil, fmt.Errorf("get graphql client: %w", err)
+	}
+
+	return graphql.Execute(ctx, request, t.client.grpcCallOptionsWithToken(token)...)
+}
+
+// transportHTTPClient returns the HTTP client used by the HTTP and WebSocket transports, going
+// through the client's proxy if any.
+func (o *clientOptions) transportHTTPClient(proxy proxyResolver) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport = proxy.httpTransport()
+	}
+
+	if o.insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// transportHeaders returns the HTTP headers carrying the outgoing metadata found in `ctx` and
+// the API `token` for the HTTP and WebSocket transports.
+func transportHeaders(ctx context.Context, token string) http.Header {
+	headers := http.Header{}
+	if md, found := metadata.FromOutgoingContext(ctx); found {
+		for key, values := range md {
+			for _, value := range values {
+				headers.Add(key, value)
+			}
+		}
+	}
+
+	if token != "" {
+		headers.Set("Authorization", "Bearer "+token)
+	}
+
+	return headers
+}
+
+// headerMetadata converts HTTP headers to gRPC metadata, for `CallInfo.Header`.
+func headerMetadata(headers http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range headers {
+		md.Append(strings.ToLower(key), values...)
+	}
+
+	return md
+}
+
+// jsonRequest is the standard JSON encoding of a GraphQL request over HTTP and WebSocket, the
+// query being omitted for a persisted query sent with only its hash.
+type jsonRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    *jsonExtensions        `json:"extensions,omitempty"`
+}
+
+type jsonExtensions struct {
+	PersistedQuery *jsonPersistedQuery `json:"persistedQuery,omitempty"`
+}
+
+type jsonPersistedQuery struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// newJSONRequest encodes `request`, along the hash of its document found in `ctx` when it's a
+// persisted query, see `WithPersistedQueries`.
+func newJSONRequest(ctx context.Context, request *pbgraphql.Request) *jsonRequest {
+	out := &jsonRequest{Query: request.Query, OperationName: request.OperationName}
+	if request.Variables != nil {
+		out.Variables = request.Variables.AsMap()
+	}
+
+	if hash := persistedQueryHash(ctx); hash != "" {
+		out.Extensions = &jsonExtensions{PersistedQuery: &jsonPersistedQuery{Version: 1, SHA256Hash: hash}}
+	}
+
+	return out
+}
+
+// jsonResponse is the standard JSON encoding of a GraphQL response over HTTP and WebSocket.
+type jsonResponse struct {
+	Data   json.RawMessage   `json:"data"`
+	Errors []json.RawMessage `json:"errors"`
+}
+
+func (r *jsonResponse) toProto() (*pbgraphql.Response, error) {
+	response := &pbgraphql.Response{}
+	if len(r.Data) > 0 && string(r.Data) != "null" {
+		response.Data = string(r.Data)
+	}
+
+	for _, rawError := range r.Errors {
+		graphqlError := &pbgraphql.Error{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(rawError, graphqlError); err != nil {
+			return nil, status.Errorf(codes.Internal, "invalid graphql error %s: %s", string(rawError), err)
+		}
+
+		response.Errors = append(response.Errors, graphqlError)
+	}
+
+	return response, nil
+}
+
+// httpStatusCode maps an HTTP status to its closest gRPC code, so that HTTP and WebSocket
+// errors are classified like gRPC ones.
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
+
+// transportError converts an error occurring while sending a request or reading its response to
+// a gRPC status error, context errors are reported as such and network errors as `Unavailable`.
+func transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// validateTransportURL ensures `in` is an absolute URL with one of the `schemes`.
+func validateTransportURL(in string, schemes ...string) error {
+	parsed, err := url.Parse(in)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", in, err)
+	}
+
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme && parsed.Host != "" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid URL %q: must be an absolute URL with scheme %s", in, strings.Join(schemes, " or "))
+}
+
+// transportStream implements the `grpc.ClientStream` part of `pbgraphql.GraphQL_ExecuteClient`
+// for the HTTP and WebSocket transports.
+type transportStream struct {
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *transportStream) Header() (metadata.MD, error) { return s.header, nil }
+func (s *transportStream) Trailer() metadata.MD         { return nil }
+func (s *transportStream) CloseSend() error             { return nil }
+func (s *transportStream) Context() context.Context     { return s.ctx }
+
+func (s *transportStream) SendMsg(m interface{}) error {
+	return status.Error(codes.Unimplemented, "sending messages is not supported by this transport")
+}
+
+func (s *transportStream) RecvMsg(m interface{}) error {
+	return status.Error(codes.Unimplemented, "receiving raw messages is not supported by this transport, use Recv")
+}
@@ -0,0 +1,126 @@
+package dfuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpTransport executes GraphQL requests over HTTP POST, see `WithHTTPTransport`.
+type httpTransport struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (t *httpTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	body, err := json.Marshal(newJSONRequest(ctx, request))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "encode request: %s", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "new request: %s", err)
+	}
+
+	httpRequest.Header = transportHeaders(ctx, token)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept", "application/json")
+
+	httpResponse, err := t.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, transportError(ctx, err)
+	}
+	defer httpResponse.Body.Close()
+
+	content, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, transportError(ctx, err)
+	}
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(httpResponse.StatusCode, content)
+	}
+
+	var decoded jsonResponse
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, status.Errorf(codes.Internal, "decode response: %s", err)
+	}
+
+	response, err := decoded.toProto()
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpStream{
+		transportStream: transportStream{ctx: ctx, header: headerMetadata(httpResponse.Header)},
+		response:        response,
+	}, nil
+}
+
+// httpStatusError is a status other than 200 OK answered to an HTTP request, mapped to its
+// closest gRPC code. When the body is a GraphQL response, its errors are available through
+// `errors.As` as `GraphQLErrors`.
+type httpStatusError struct {
+	status *status.Status
+	errors GraphQLErrors
+}
+
+func newHTTPStatusError(statusCode int, content []byte) *httpStatusError {
+	out := &httpStatusError{
+		status: status.Newf(httpStatusCode(statusCode), "http status %d: %s", statusCode, truncate(string(content), 256)),
+	}
+
+	var decoded jsonResponse
+	if err := json.Unmarshal(content, &decoded); err == nil {
+		if response, err := decoded.toProto(); err == nil {
+			out.errors = newGraphQLErrors(response.Errors)
+		}
+	}
+
+	return out
+}
+
+func (e *httpStatusError) Error() string              { return e.status.Err().Error() }
+func (e *httpStatusError) GRPCStatus() *status.Status { return e.status }
+
+func (e *httpStatusError) Unwrap() error {
+	if e.errors == nil {
+		return nil
+	}
+
+	return e.errors
+}
+
+// httpStream yields the single response of an HTTP request.
+type httpStream struct {
+	transportStream
+	response *pbgraphql.Response
+}
+
+func (s *httpStream) Recv() (*pbgraphql.Response, error) {
+	if s.response == nil {
+		return nil, io.EOF
+	}
+
+	response := s.response
+	s.response = nil
+
+	return response, nil
+}
+
+func truncate(in string, max int) string {
+	if len(in) <= max {
+		return in
+	}
+
+	return fmt.Sprintf("%s... (%d bytes truncated)", in[:max], len(in)-max)
+}
@@ -0,0 +1,149 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		body             string
+		retry            bool
+		expectedData     string
+		expectedErrors   []string
+		expectedCode     codes.Code
+		expectedRequests int32
+	}{
+		{"data", nil, `{"data":{"ping":"pong"}}`, false, `{"ping":"pong"}`, nil, codes.OK, 1},
+		{"graphql errors", nil, `{"data":null,"errors":[{"message":"boom","locations":[{"line":1,"column":3}],"extensions":{"code":"X"}}]}`, false, "", []string{"boom"}, codes.OK, 1},
+		{"unavailable", []int{503}, ``, false, "", nil, codes.Unavailable, 1},
+		{"too many requests", []int{429}, ``, false, "", nil, codes.ResourceExhausted, 1},
+		{"unauthorized", []int{401}, ``, false, "", nil, codes.Unauthenticated, 1},
+		{"retried transient", []int{503, 502}, `{"data":{"ping":"pong"}}`, true, `{"ping":"pong"}`, nil, codes.OK, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statuses, body := test.statuses, test.body
+			requests := atomic.NewInt32(0)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request := int(requests.Inc()) - 1
+
+				var decoded jsonRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&decoded))
+				assert.Equal(t, "{ ping }", decoded.Query)
+				assert.Equal(t, map[string]interface{}{"limit": float64(10)}, decoded.Variables)
+				assert.Equal(t, "acme", r.Header.Get("x-tenant"))
+				assert.Equal(t, "", r.Header.Get("Authorization"))
+				assert.NotEmpty(t, r.Header.Get(RequestIDMetadataKey))
+
+				w.Header().Set("X-Cost", "12")
+				if request < len(statuses) {
+					w.WriteHeader(statuses[request])
+					return
+				}
+
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			options := []ClientOption{WithoutAuthentication(), WithHTTPTransport(server.URL), WithMetadata(map[string]string{"x-tenant": "acme"})}
+			if test.retry {
+				options = append(options, WithQueryRetry(RetryPolicy{InitialBackoff: time.Millisecond}))
+			}
+
+			client, err := NewClient("localhost:1", "", options...)
+			require.NoError(t, err)
+
+			info := &CallInfo{}
+			response, err := client.GraphQLQuery(context.Background(), "{ ping }", GraphQLVariables{"limit": 10}, GraphQLCallInfo(info))
+			assert.Equal(t, test.expectedRequests, requests.Load())
+
+			if test.expectedCode != codes.OK {
+				assert.Equal(t, test.expectedCode, grpcCode(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedData, response.Data)
+			assert.Equal(t, test.expectedErrors, errorMessages(response.Errors))
+			assert.Equal(t, []string{"12"}, info.Header.Get("x-cost"))
+			assert.Equal(t, codes.OK, info.Status.Code())
+		})
+	}
+}
+
+func TestWithGraphQLTransport(t *testing.T) {
+	transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{"a":1}`}, {Data: `{"a":2}`}}}
+
+	client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport))
+	require.NoError(t, err)
+
+	stream, err := client.GraphQLSubscription(context.Background(), "subscription { a }")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`{"a":1}`, `{"a":2}`}, receiveAll(t, stream))
+	assert.Equal(t, "subscription { a }", transport.request.Query)
+}
+
+type testTransport struct {
+	request   *pbgraphql.Request
+	responses []*pbgraphql.Response
+}
+
+func (t *testTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	t.request = request
+	return &testTransportStream{transportStream: transportStream{ctx: ctx}, responses: t.responses}, nil
+}
+
+type testTransportStream struct {
+	transportStream
+	responses []*pbgraphql.Response
+}
+
+func (s *testTransportStream) Recv() (*pbgraphql.Response, error) {
+	if len(s.responses) == 0 {
+		return nil, io.EOF
+	}
+
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+
+	return response, nil
+}
+
+func errorMessages(errs []*pbgraphql.Error) (out []string) {
+	for _, err := range errs {
+		out = append(out, err.Message)
+	}
+
+	return
+}
+
+// receiveAll receives all the responses of `stream` until it completes, returning their data
+func receiveAll(t *testing.T, stream GraphQLStream) (out []string) {
+	t.Helper()
+
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+
+		require.NoError(t, err)
+		out = append(out, response.Data)
+	}
+}
@@ -0,0 +1,413 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WebSocketProtocol is a GraphQL over WebSocket protocol, identified by its WebSocket sub-protocol.
+type WebSocketProtocol string
+
+const (
+	// GraphQLTransportWS is the protocol of the `graphql-ws` library, whose WebSocket sub-protocol
+	// is confusingly named `graphql-transport-ws`.
+	GraphQLTransportWS WebSocketProtocol = "graphql-transport-ws"
+
+	// SubscriptionsTransportWS is the legacy protocol of the `subscriptions-transport-ws` library,
+	// whose WebSocket sub-protocol is named `graphql-ws`.
+	SubscriptionsTransportWS WebSocketProtocol = "graphql-ws"
+)
+
+// WithWebSocketTransport is an option to execute GraphQL subscriptions over WebSocket connections
+// to `endpointURL` (like `wss://mainnet.eos.dfuse.io/graphql`) speaking `protocol`, instead of
+// gRPC. Queries are executed over WebSocket too, unless `WithHTTPTransport` is used.
+//
+// Each call opens its own connection. The client's metadata is sent as HTTP headers of the
+// WebSocket handshake and the API token both as an `Authorization: Bearer` header and in the
+// `connection_init` payload. When the connection breaks, the next `Recv` of the subscription
+// re-connects and re-subscribes, like the gRPC transport.
+//
+// Re-subscribing runs the operation again from scratch with the same variables, the server has
+// no way to know what was already received: messages sent before the connection broke are
+// received again. Callers must de-duplicate them, for instance on the cursor of each message.
+func WithWebSocketTransport(endpointURL string, protocol WebSocketProtocol) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) {
+		o.webSocketURL = endpointURL
+		o.webSocketProtocol = protocol
+	})
+}
+
+// webSocketStreamID is the ID of the single operation sent over each WebSocket connection.
+const webSocketStreamID = "1"
+
+var webSocketMaxBackoff = 5 * time.Second
+
+type webSocketMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// webSocketTransport executes GraphQL requests over WebSocket, see `WithWebSocketTransport`.
+type webSocketTransport struct {
+	url      string
+	protocol WebSocketProtocol
+	dialer   *websocket.Dialer
+	logger   *zap.Logger
+}
+
+func newWebSocketTransport(endpointURL string, protocol WebSocketProtocol, httpClient *http.Client, logger *zap.Logger) *webSocketTransport {
+	httpTransport := httpClient.Transport.(*http.Transport)
+
+	return &webSocketTransport{
+		url:      endpointURL,
+		protocol: protocol,
+		dialer: &websocket.Dialer{
+			Proxy:            httpTransport.Proxy,
+			TLSClientConfig:  httpTransport.TLSClientConfig,
+			HandshakeTimeout: 30 * time.Second,
+			Subprotocols:     []string{string(protocol)},
+		},
+		logger: logger,
+	}
+}
+
+func (t *webSocketTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	stream := &webSocketStream{
+		transportStream: transportStream{ctx: ctx},
+		transport:       t,
+		request:         newJSONRequest(ctx, request),
+		token:           token,
+		done:            make(chan struct{}),
+	}
+
+	if err := stream.connect(); err != nil {
+		stream.close()
+		return nil, err
+	}
+
+	go stream.closeOnCancel()
+	return stream, nil
+}
+
+// webSocketStream is a GraphQL operation over a WebSocket connection, re-connected on the next
+// `Recv` when the connection breaks.
+type webSocketStream struct {
+	transportStream
+
+	transport *webSocketTransport
+	request   *jsonRequest
+	token     string
+
+	// lock protects `conn` which is replaced on re-connection and written to concurrently
+	lock       sync.Mutex
+	conn       *websocket.Conn
+	broken     bool
+	reconnects int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	completed bool
+}
+
+func (s *webSocketStream) Recv() (*pbgraphql.Response, error) {
+	if s.completed {
+		return nil, io.EOF
+	}
+
+	if s.broken {
+		if err := s.reconnect(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		message, err := s.read()
+		if err != nil {
+			return nil, err
+		}
+
+		switch message.Type {
+		case "next", "data":
+			var response jsonResponse
+			if err := json.Unmarshal(message.Payload, &response); err != nil {
+				return nil, status.Errorf(codes.Internal, "decode %s message: %s", message.Type, err)
+			}
+
+			s.reconnects = 0
+			return response.toProto()
+
+		case "error":
+			// The operation failed before execution (i.e. validation), it's terminated
+			s.complete()
+			response, err := webSocketErrorResponse(message.Payload)
+			if err != nil {
+				return nil, err
+			}
+
+			return response, nil
+
+		case "complete":
+			s.complete()
+			return nil, io.EOF
+
+		case "ping":
+			if err := s.write(webSocketMessage{Type: "pong"}); err != nil {
+				return nil, err
+			}
+
+		case "connection_error":
+			s.complete()
+			return nil, status.Errorf(codes.Unauthenticated, "connection error: %s", string(message.Payload))
+
+		default:
+			// Keep alive (`ka`), `pong` and unknown messages
+			if tracer.Enabled() {
+				s.transport.logger.Debug("ignoring websocket message", zap.String("type", message.Type))
+			}
+		}
+	}
+}
+
+// connect dials the endpoint, initializes the connection and subscribes to the operation.
+func (s *webSocketStream) connect() error {
+	conn, response, err := s.transport.dialer.DialContext(s.ctx, s.transport.url, transportHeaders(s.ctx, s.token))
+	if err != nil {
+		if response != nil {
+			return status.Errorf(httpStatusCode(response.StatusCode), "websocket handshake failed with http status %d", response.StatusCode)
+		}
+
+		return transportError(s.ctx, err)
+	}
+
+	s.lock.Lock()
+	select {
+	case <-s.done:
+		// Closed while connecting
+		s.lock.Unlock()
+		conn.Close()
+		return status.FromContextError(context.Canceled).Err()
+	default:
+	}
+
+	s.conn = conn
+	s.broken = false
+	s.header = headerMetadata(response.Header)
+	s.lock.Unlock()
+
+	initPayload := map[string]string{}
+	if s.token != "" {
+		initPayload["Authorization"] = "Bearer " + s.token
+	}
+
+	if err := s.write(webSocketMessage{Type: "connection_init", Payload: mustJSON(initPayload)}); err != nil {
+		return err
+	}
+
+	for acknowledged := false; !acknowledged; {
+		message, err := s.read()
+		if err != nil {
+			return err
+		}
+
+		switch message.Type {
+		case "connection_ack":
+			acknowledged = true
+		case "connection_error":
+			return status.Errorf(codes.Unauthenticated, "connection error: %s", string(message.Payload))
+		case "ping":
+			if err := s.write(webSocketMessage{Type: "pong"}); err != nil {
+				return err
+			}
+		}
+	}
+
+	subscribe := "subscribe"
+	if s.transport.protocol == SubscriptionsTransportWS {
+		subscribe = "start"
+	}
+
+	return s.write(webSocketMessage{ID: webSocketStreamID, Type: subscribe, Payload: mustJSON(s.request)})
+}
+
+// Header returns the headers of the handshake response of the current connection, replaced on
+// re-connection.
+func (s *webSocketStream) Header() (metadata.MD, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.header, nil
+}
+
+// reconnect re-connects a broken stream after a backoff growing with consecutive re-connections.
+func (s *webSocketStream) reconnect() error {
+	backoff := time.Duration(1<<uint(s.reconnects)) * 250 * time.Millisecond
+	if backoff > webSocketMaxBackoff || backoff <= 0 {
+		backoff = webSocketMaxBackoff
+	}
+
+	s.reconnects++
+	s.transport.logger.Debug("re-connecting broken websocket stream", zap.Int("attempt", s.reconnects), zap.Duration("backoff", backoff))
+
+	select {
+	case <-s.ctx.Done():
+		return status.FromContextError(s.ctx.Err()).Err()
+	case <-time.After(backoff):
+	}
+
+	if err := s.connect(); err != nil {
+		s.markBroken()
+		return err
+	}
+
+	return nil
+}
+
+func (s *webSocketStream) read() (*webSocketMessage, error) {
+	s.lock.Lock()
+	conn := s.conn
+	s.lock.Unlock()
+
+	_, content, err := conn.ReadMessage()
+	if err != nil {
+		s.markBroken()
+		return nil, s.readError(err)
+	}
+
+	message := &webSocketMessage{}
+	if err := json.Unmarshal(content, message); err != nil {
+		return nil, status.Errorf(codes.Internal, "decode websocket message: %s", err)
+	}
+
+	return message, nil
+}
+
+func (s *webSocketStream) write(message webSocketMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.conn.WriteJSON(message); err != nil {
+		return transportError(s.ctx, err)
+	}
+
+	return nil
+}
+
+// readError converts an error reading from the connection to a gRPC status error, WebSocket close
+// codes defined by the GraphQL over WebSocket protocols are mapped to their gRPC equivalent.
+func (s *webSocketStream) readError(err error) error {
+	if s.ctx.Err() != nil {
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	switch closeErr.Code {
+	case websocket.CloseNormalClosure:
+		s.completed = true
+		return io.EOF
+	case 4400:
+		return status.Error(codes.InvalidArgument, closeErr.Error())
+	case 4401:
+		return status.Error(codes.Unauthenticated, closeErr.Error())
+	case 4403:
+		return status.Error(codes.PermissionDenied, closeErr.Error())
+	case 4409:
+		return status.Error(codes.AlreadyExists, closeErr.Error())
+	case 4429:
+		return status.Error(codes.ResourceExhausted, closeErr.Error())
+	case 4500, websocket.CloseInternalServerErr:
+		return status.Error(codes.Internal, closeErr.Error())
+	default:
+		return status.Error(codes.Unavailable, closeErr.Error())
+	}
+}
+
+func (s *webSocketStream) markBroken() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
+	s.broken = true
+}
+
+// complete marks the operation as terminated by the server and releases the connection.
+func (s *webSocketStream) complete() {
+	s.completed = true
+	s.close()
+}
+
+func (s *webSocketStream) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	})
+}
+
+// closeOnCancel stops the operation and releases the connection once the call's context is done.
+func (s *webSocketStream) closeOnCancel() {
+	select {
+	case <-s.done:
+		return
+	case <-s.ctx.Done():
+	}
+
+	stop := "complete"
+	if s.transport.protocol == SubscriptionsTransportWS {
+		stop = "stop"
+	}
+
+	s.lock.Lock()
+	if s.conn != nil && !s.broken {
+		// Best effort, the connection is closed right after anyway
+		s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		s.conn.WriteJSON(webSocketMessage{ID: webSocketStreamID, Type: stop})
+	}
+	s.lock.Unlock()
+
+	s.close()
+}
+
+// webSocketErrorResponse converts the payload of an `error` message, a list of GraphQL errors
+// (or a single one for the legacy protocol), to a response.
+func webSocketErrorResponse(payload json.RawMessage) (*pbgraphql.Response, error) {
+	var errs []json.RawMessage
+	if err := json.Unmarshal(payload, &errs); err != nil {
+		errs = []json.RawMessage{payload}
+	}
+
+	return (&jsonResponse{Errors: errs}).toProto()
+}
+
+func mustJSON(in interface{}) json.RawMessage {
+	out, err := json.Marshal(in)
+	if err != nil {
+		panic(err)
+	}
+
+	return out
+}
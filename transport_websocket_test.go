@@ -0,0 +1,136 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+)
+
+func TestWebSocketTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		protocol     WebSocketProtocol
+		connections  []testWebSocketScenario
+		expectedData []string
+		expectedCode codes.Code
+	}{
+		{
+			"graphql-transport-ws", GraphQLTransportWS,
+			[]testWebSocketScenario{{data: []string{`{"a":1}`, `{"a":2}`}, complete: true}},
+			[]string{`{"a":1}`, `{"a":2}`}, codes.OK,
+		},
+		{
+			"subscriptions-transport-ws", SubscriptionsTransportWS,
+			[]testWebSocketScenario{{data: []string{`{"a":1}`}, complete: true}},
+			[]string{`{"a":1}`}, codes.OK,
+		},
+		{
+			"reconnects on broken connection", GraphQLTransportWS,
+			[]testWebSocketScenario{{data: []string{`{"a":1}`}}, {data: []string{`{"a":2}`}, complete: true}},
+			[]string{`{"a":1}`, `{"a":2}`}, codes.OK,
+		},
+		{
+			"permanent close code", GraphQLTransportWS,
+			[]testWebSocketScenario{{closeCode: 4403}},
+			nil, codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			protocol, connections := test.protocol, test.connections
+			connection := atomic.NewInt32(0)
+			upgrader := websocket.Upgrader{Subprotocols: []string{string(protocol)}}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "acme", r.Header.Get("x-tenant"))
+
+				conn, err := upgrader.Upgrade(w, r, nil)
+				require.NoError(t, err)
+				defer conn.Close()
+
+				assert.Equal(t, string(protocol), conn.Subprotocol())
+				scenario := connections[int(connection.Inc())-1]
+
+				var message webSocketMessage
+				require.NoError(t, conn.ReadJSON(&message))
+				require.Equal(t, "connection_init", message.Type)
+				require.NoError(t, conn.WriteJSON(webSocketMessage{Type: "connection_ack"}))
+
+				require.NoError(t, conn.ReadJSON(&message))
+				expectedType, dataType := "subscribe", "next"
+				if protocol == SubscriptionsTransportWS {
+					expectedType, dataType = "start", "data"
+				}
+
+				require.Equal(t, expectedType, message.Type)
+				var request jsonRequest
+				require.NoError(t, json.Unmarshal(message.Payload, &request))
+				assert.Equal(t, "subscription { a }", request.Query)
+
+				if scenario.closeCode != 0 {
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(scenario.closeCode, "forbidden"))
+					return
+				}
+
+				require.NoError(t, conn.WriteJSON(webSocketMessage{Type: "ping"}))
+				for _, data := range scenario.data {
+					require.NoError(t, conn.WriteJSON(webSocketMessage{ID: message.ID, Type: dataType, Payload: json.RawMessage(`{"data":` + data + `}`)}))
+				}
+
+				if scenario.complete {
+					require.NoError(t, conn.WriteJSON(webSocketMessage{ID: message.ID, Type: "complete"}))
+				}
+
+				// Without completion, returning drops the connection abruptly
+			}))
+			defer server.Close()
+
+			webSocketURL := "ws" + strings.TrimPrefix(server.URL, "http")
+			client, err := NewClient("", "", WithoutAuthentication(), WithWebSocketTransport(webSocketURL, protocol), WithMetadata(map[string]string{"x-tenant": "acme"}))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			stream, err := client.GraphQLSubscription(ctx, "subscription { a }")
+			require.NoError(t, err)
+
+			var data []string
+			for {
+				response, err := stream.Recv()
+				if err != nil {
+					if test.expectedCode == codes.OK {
+						require.Equal(t, io.EOF, err)
+					} else {
+						assert.Equal(t, test.expectedCode, grpcCode(err))
+					}
+
+					break
+				}
+
+				data = append(data, response.Data)
+			}
+
+			assert.Equal(t, test.expectedData, data)
+			assert.Equal(t, int32(len(connections)), connection.Load())
+		})
+	}
+}
+
+type testWebSocketScenario struct {
+	data      []string
+	complete  bool
+	closeCode int
+}
@@ -0,0 +1,271 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ValidationError is returned when a document or its variables are invalid against the schema,
+// see `WithDocumentValidation`. It unwraps to its `GraphQLErrors`, each locating the faulty part
+// of the document.
+type ValidationError struct {
+	Errors GraphQLErrors
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, graphqlErr := range e.Errors {
+		messages[i] = graphqlErr.Error()
+		if len(graphqlErr.Locations) > 0 {
+			messages[i] = fmt.Sprintf("%d:%d: %s", graphqlErr.Locations[0].Line, graphqlErr.Locations[0].Column, messages[i])
+		}
+	}
+
+	return "invalid graphql document: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Errors
+}
+
+// GRPCStatus reports validation failures as `InvalidArgument`, like the server would, so that
+// they are neither retried nor counted as circuit breaker failures.
+func (e *ValidationError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// WithDocumentValidation is an option to validate documents and variables against `schema`
+// before sending them, invalid ones failing right away with a `*ValidationError` instead of an
+// opaque server error. When `schema` is `nil`, the endpoint's schema is used, see
+// `Client.GraphQLSchema`.
+func WithDocumentValidation(schema *GraphQLSchema) ClientOption {
+	return clientOptionFunc(func(o *clientOptions) {
+		o.documentValidation = true
+		o.validationSchema = schema
+	})
+}
+
+// skipValidation is used internally to send the introspection query, which is needed to
+// validate other documents.
+var skipValidation = graphqlOptionFunc(func(o *graphqlOptions) { o.skipValidation = true })
+
+// documentValidationSchema returns the schema documents are validated against, the one received
+// in options or the endpoint's one.
+func (c *client) documentValidationSchema(ctx context.Context) (*GraphQLSchema, error) {
+	if c.validationSchema != nil {
+		return c.validationSchema, nil
+	}
+
+	schema, err := c.GraphQLSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("validate document: %w", err)
+	}
+
+	return schema, nil
+}
+
+// Validate checks `document` against the schema: syntax, unknown types and fields, argument
+// types, fragments and variables usage. When `variables` is not `nil`, they are checked against
+// the definitions of the operation `operationName` (empty for a document with a single
+// operation, an error otherwise): missing required ones, unknown input fields and scalar
+// mismatches. Problems are reported as a `*ValidationError`.
+func (s *GraphQLSchema) Validate(document string, variables map[string]interface{}, operationName string) error {
+	parsed, err := parser.ParseQuery(&ast.Source{Input: document})
+	if err != nil {
+		return newValidationError(gqlerror.List{toGQLError(err)})
+	}
+
+	return s.validate(parsed, variables, operationName)
+}
+
+// validate is `Validate` for an already parsed document, which the validator annotates with the
+// schema definitions of its fields and fragments.
+func (s *GraphQLSchema) validate(parsed *ast.QueryDocument, variables map[string]interface{}, operationName string) error {
+	if errs := validator.Validate(s.Schema, parsed); len(errs) > 0 {
+		return newValidationError(errs)
+	}
+
+	if variables == nil {
+		return nil
+	}
+
+	operation := parsed.Operations.ForName(operationName)
+	if operation == nil {
+		var position *ast.Position
+		if len(parsed.Operations) > 0 {
+			position = parsed.Operations[0].Position
+		}
+
+		if operationName == "" {
+			return newValidationError(gqlerror.List{gqlerror.ErrorPosf(position, "an operation name is required to check variables of a document with multiple operations")})
+		}
+
+		return newValidationError(gqlerror.List{gqlerror.ErrorPosf(position, "unknown operation %q", operationName)})
+	}
+
+	if _, err := validator.VariableValues(s.Schema, operation, variables); err != nil {
+		return newVariableValidationError(operation, toGQLError(err))
+	}
+
+	for _, definition := range operation.VariableDefinitions {
+		value, found := variables[definition.Variable]
+		if !found {
+			continue
+		}
+
+		path := ast.Path{ast.PathName("variable"), ast.PathName(definition.Variable)}
+		if err := s.checkCustomScalars(definition.Type, value, path); err != nil {
+			return newVariableValidationError(operation, err)
+		}
+	}
+
+	return nil
+}
+
+// integerScalars are the custom scalars of dfuse schemas carrying integers as JSON numbers,
+// with their bounds. Custom scalars are otherwise opaque to the validator which accepts any value.
+var integerScalars = map[string][2]float64{
+	"Int8":   {math.MinInt8, math.MaxInt8},
+	"Int16":  {math.MinInt16, math.MaxInt16},
+	"Int32":  {math.MinInt32, math.MaxInt32},
+	"Uint8":  {0, math.MaxUint8},
+	"Uint16": {0, math.MaxUint16},
+	"Uint32": {0, math.MaxUint32},
+}
+
+// checkCustomScalars checks the values of `integerScalars` found in `value` of type `typ`, the
+// value being otherwise valid (see `validator.VariableValues`).
+func (s *GraphQLSchema) checkCustomScalars(typ *ast.Type, value interface{}, path ast.Path) *gqlerror.Error {
+	if value == nil {
+		return nil
+	}
+
+	if typ.Elem != nil {
+		values, isList := value.([]interface{})
+		if !isList {
+			// Single value coerced to a list
+			return s.checkCustomScalars(typ.Elem, value, path)
+		}
+
+		for i, element := range values {
+			if err := s.checkCustomScalars(typ.Elem, element, append(path, ast.PathIndex(i))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	definition := s.Types[typ.NamedType]
+	if definition == nil {
+		return nil
+	}
+
+	switch definition.Kind {
+	case ast.InputObject:
+		fields, _ := value.(map[string]interface{})
+		for _, field := range definition.Fields {
+			if err := s.checkCustomScalars(field.Type, fields[field.Name], append(path, ast.PathName(field.Name))); err != nil {
+				return err
+			}
+		}
+	case ast.Scalar:
+		bounds, found := integerScalars[definition.Name]
+		if !found {
+			return nil
+		}
+
+		number, isNumber := toFloat64(value)
+		if !isNumber {
+			return gqlerror.ErrorPathf(path, "cannot use %T as %s", value, definition.Name)
+		}
+
+		if number != math.Trunc(number) || number < bounds[0] || number > bounds[1] {
+			return gqlerror.ErrorPathf(path, "value %v is not a valid %s", value, definition.Name)
+		}
+	}
+
+	return nil
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case uint32:
+		return float64(number), true
+	case uint64:
+		return float64(number), true
+	case json.Number:
+		value, err := number.Float64()
+		return value, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toGQLError(err error) *gqlerror.Error {
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+
+	return &gqlerror.Error{Message: err.Error()}
+}
+
+func newValidationError(errs gqlerror.List) *ValidationError {
+	out := &ValidationError{}
+	for _, gqlErr := range errs {
+		converted := &GraphQLError{Message: gqlErr.Message}
+		for _, location := range gqlErr.Locations {
+			converted.Locations = append(converted.Locations, GraphQLErrorLocation{Line: location.Line, Column: location.Column})
+		}
+
+		for _, element := range gqlErr.Path {
+			switch element := element.(type) {
+			case ast.PathIndex:
+				converted.Path = append(converted.Path, float64(element))
+			case ast.PathName:
+				converted.Path = append(converted.Path, string(element))
+			}
+		}
+
+		out.Errors = append(out.Errors, converted)
+	}
+
+	return out
+}
+
+// newVariableValidationError converts `err`, whose path starts with `variable.<name>`, locating
+// it at the variable's definition in `operation`.
+func newVariableValidationError(operation *ast.OperationDefinition, err *gqlerror.Error) *ValidationError {
+	out := newValidationError(gqlerror.List{err})
+	if len(err.Path) > 1 {
+		if name, isName := err.Path[1].(ast.PathName); isName {
+			if definition := operation.VariableDefinitions.ForName(string(name)); definition != nil && definition.Position != nil {
+				out.Errors[0].Locations = []GraphQLErrorLocation{{Line: definition.Position.Line, Column: definition.Position.Column}}
+			}
+		}
+	}
+
+	return out
+}
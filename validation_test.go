@@ -0,0 +1,172 @@
+package dfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGraphQLSchema_Validate(t *testing.T) {
+	schema, err := NewGraphQLSchema([]byte(testIntrospection))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		document      string
+		variables     map[string]interface{}
+		operationName string
+		expectedErr   string
+	}{
+		{"valid", "query ($num: Uint32!) { block(num: $num) { id number } }", map[string]interface{}{"num": float64(10)}, "", ""},
+		{"valid without variables check", "query ($num: Uint32!) { block(num: $num) { id } }", nil, "", ""},
+		{"syntax error", "{ block(num: 1) { id }", nil, "", `invalid graphql document: 1:23: Expected Name, found <EOF>`},
+		{"unknown field", "{ block(num: 1) {\n  id\n  hash\n} }", nil, "", `invalid graphql document: 3:3: Cannot query field "hash" on type "Block".`},
+		{"wrong argument type", `{ blocks(limit: "ten") { id } }`, nil, "", `invalid graphql document: 1:18: Int cannot represent non-integer value: "ten"`},
+		{"missing required variable", "query ($num: Uint32!) { block(num: $num) { id } }", map[string]interface{}{}, "", "invalid graphql document: 1:8: must be defined (at variable.num)"},
+		{"scalar mismatch", "query (\n  $num: Uint32!\n) { block(num: $num) { id } }", map[string]interface{}{"num": "10"}, "", "invalid graphql document: 2:3: cannot use string as Uint32 (at variable.num)"},
+		{"scalar out of bounds", "query ($num: Uint32!) { block(num: $num) { id } }", map[string]interface{}{"num": float64(-1)}, "", "invalid graphql document: 1:8: value -1 is not a valid Uint32 (at variable.num)"},
+		{"builtin scalar mismatch", "query ($limit: Int) { blocks(limit: $limit) { id } }", map[string]interface{}{"limit": true}, "", "invalid graphql document: 1:8: cannot use bool as Int (at variable.limit)"},
+		{"unknown input field", "subscription ($filter: TransferFilter) { transfers(filter: $filter) { __typename } }", map[string]interface{}{"filter": map[string]interface{}{"to": "eoscanadacom"}}, "", "invalid graphql document: 1:15: unknown field (at variable.filter.to)"},
+		{"multiple operations without name", "query A { blocks { id } }\nquery B($num: Uint32!) { block(num: $num) { id } }", map[string]interface{}{}, "", "invalid graphql document: 1:1: an operation name is required to check variables of a document with multiple operations"},
+		{"unknown operation", "query A { blocks { id } }", map[string]interface{}{}, "B", `invalid graphql document: 1:1: unknown operation "B"`},
+		{"selected operation", "query A { blocks { id } }\nquery B($num: Uint32!) { block(num: $num) { id } }", map[string]interface{}{}, "B", "invalid graphql document: 2:9: must be defined (at variable.num)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := schema.Validate(test.document, test.variables, test.operationName)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, test.expectedErr, err.Error())
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			assert.NotEmpty(t, validationErr.Errors[0].Locations)
+		})
+	}
+}
+
+func TestWithDocumentValidation(t *testing.T) {
+	schema, err := NewGraphQLSchema([]byte(testIntrospection))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		schema        *GraphQLSchema
+		responses     []*pbgraphql.Response
+		document      string
+		expectedErr   string
+		expectedQuery string
+	}{
+		{"supplied schema valid", schema, []*pbgraphql.Response{{Data: `{}`}}, "{ blocks { id } }", "", "{ blocks { id } }"},
+		{"supplied schema invalid", schema, nil, "{ blocks { hash } }", `1:12: Cannot query field "hash" on type "Block".`, ""},
+		{"supplied schema unparsable", schema, nil, "{ blocks {", "1:11: Expected Name, found <EOF>", ""},
+		{"supplied schema undefined fragment", schema, nil, "{ blocks { ...Missing } }", "unknown fragment(s) Missing", ""},
+		{"introspected schema valid", nil, []*pbgraphql.Response{{Data: testIntrospection}, {Data: `{}`}}, "{ blocks { id } }", "", "{ blocks { id } }"},
+		{"introspected schema invalid", nil, []*pbgraphql.Response{{Data: testIntrospection}}, "{ blocks { hash } }", `1:12: Cannot query field "hash" on type "Block".`, IntrospectionQuery},
+		{"introspection failure", nil, []*pbgraphql.Response{{Errors: []*pbgraphql.Error{{Message: "disabled"}}}}, "{ blocks { id } }", "validate document: introspect schema: graphql errors: disabled", IntrospectionQuery},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &sequenceTransport{responses: test.responses}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithSchemaCache("", 0), WithDocumentValidation(test.schema))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(context.Background(), test.document)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var lastQuery string
+			if len(transport.requests) > 0 {
+				lastQuery = transport.requests[len(transport.requests)-1].Query
+			}
+
+			assert.Equal(t, test.expectedQuery, lastQuery)
+		})
+	}
+}
+
+func TestWithDocumentValidation_RegisteredFragments(t *testing.T) {
+	schema, err := NewGraphQLSchema([]byte(testIntrospection))
+	require.NoError(t, err)
+
+	registry := NewFragmentRegistry()
+	require.NoError(t, registry.Register("fragment BlockID on Block { id }\nfragment BlockHash on Block { hash }"))
+
+	// Registered fragments are shared by the calls validated concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithFragmentRegistry(registry), WithDocumentValidation(schema))
+			require.NoError(t, err)
+
+			for j := 0; j < 20; j++ {
+				_, err := client.GraphQLQuery(context.Background(), "query Other { blocks { id } }\nquery Blocks { blocks { ...BlockID } }", GraphQLOperationName("Blocks"))
+				assert.NoError(t, err)
+
+				_, err = client.GraphQLQuery(context.Background(), "{ blocks { ...BlockHash } }")
+				assert.Contains(t, fmt.Sprint(err), `Cannot query field "hash" on type "Block".`)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestWithDocumentValidation_RateLimited(t *testing.T) {
+	transport := &sequenceTransport{responses: []*pbgraphql.Response{{Data: testIntrospection}, {Data: `{}`}}}
+	client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport), WithSchemaCache("", 0), WithDocumentValidation(nil),
+		WithRateLimit(RateLimit{QueriesPerSecond: 0.001, FailFast: true}),
+	)
+	require.NoError(t, err)
+
+	_, err = client.GraphQLQuery(context.Background(), "{ blocks { id } }")
+	require.NoError(t, err)
+	require.Len(t, transport.requests, 2)
+	assert.Equal(t, IntrospectionQuery, transport.requests[0].Query)
+
+	_, err = client.GraphQLQuery(context.Background(), "{ blocks { id } }")
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
+
+func TestValidationError_GRPCStatus(t *testing.T) {
+	err := &ValidationError{Errors: GraphQLErrors{{Message: "invalid"}}}
+	assert.Equal(t, codes.InvalidArgument, grpcCode(err))
+}
+
+// sequenceTransport answers each call with the next of its responses
+type sequenceTransport struct {
+	requests  []*pbgraphql.Request
+	responses []*pbgraphql.Response
+}
+
+func (t *sequenceTransport) Execute(ctx context.Context, request *pbgraphql.Request, token string) (pbgraphql.GraphQL_ExecuteClient, error) {
+	t.requests = append(t.requests, request)
+
+	var responses []*pbgraphql.Response
+	if len(t.responses) > 0 {
+		responses, t.responses = t.responses[:1], t.responses[1:]
+	}
+
+	return &testTransportStream{transportStream: transportStream{ctx: ctx}, responses: responses}, nil
+}
@@ -0,0 +1,161 @@
+package dfuse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// GraphQLVariablesOf option to pass the variables defined by `variables`, a struct (honouring
+// `json` tags) or a map, through its JSON encoding. Values of any type marshalling to JSON are
+// accepted, like `time.Time` or custom types implementing `json.Marshaler`, see
+// `GraphQLVariables` for how numbers are sent. A `nil` value defines no variables.
+func GraphQLVariablesOf(variables interface{}) GraphQLOption {
+	return graphqlOptionFunc(func(o *graphqlOptions) {
+		decoded, err := decodeVariables(variables)
+		if err != nil {
+			o.variablesErr = err
+			return
+		}
+
+		GraphQLVariables(decoded).apply(o)
+	})
+}
+
+// decodeVariables returns `variables` as decoded from its JSON encoding, numbers being kept as
+// `json.Number`.
+func decodeVariables(variables interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(variables)
+	if err != nil {
+		return nil, fmt.Errorf("encode variables: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var out map[string]interface{}
+	if err := decoder.Decode(&out); err != nil {
+		return nil, fmt.Errorf("variables must encode to a JSON object: %w", err)
+	}
+
+	return out, nil
+}
+
+// maxExactInteger is the largest integer magnitude a float64 represents exactly
+const maxExactInteger = 1 << 53
+
+// variableTypes resolves the GraphQL types of variables: from the definitions of the operation
+// and, for the fields of input objects, from the schema when it's known.
+type variableTypes struct {
+	definitions ast.VariableDefinitionList
+	schema      *ast.Schema
+}
+
+// fieldType returns the type of the field `name` of input object `typ`, nil when unknown.
+func (t *variableTypes) fieldType(typ *ast.Type, name string) *ast.Type {
+	if typ == nil || t.schema == nil {
+		return nil
+	}
+
+	definition := t.schema.Types[typ.Name()]
+	if definition == nil || definition.Kind != ast.InputObject {
+		return nil
+	}
+
+	if field := definition.Fields.ForName(name); field != nil {
+		return field.Type
+	}
+
+	return nil
+}
+
+// newVariablesStruct converts `variables` to the Protobuf `Struct` sent with the request, going
+// through their JSON encoding. Integers a float64 cannot represent exactly (like `Int64` or
+// `Uint64` block numbers and amounts above 2^53) are sent as strings, the form dfuse custom
+// scalars accept, instead of losing precision, unless `types` tells they are of a builtin scalar.
+func newVariablesStruct(variables map[string]interface{}, types *variableTypes) (*structpb.Struct, error) {
+	decoded, err := decodeVariables(variables)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]*structpb.Value, len(decoded))
+	for key, value := range decoded {
+		var typ *ast.Type
+		if definition := types.definitions.ForName(key); definition != nil {
+			typ = definition.Type
+		}
+
+		if fields[key], err = newVariableValue(value, typ, types); err != nil {
+			return nil, fmt.Errorf("variable %q: %w", key, err)
+		}
+	}
+
+	return &structpb.Struct{Fields: fields}, nil
+}
+
+// newVariableValue converts `value` of type `typ` (nil when unknown) to a Protobuf `Value`.
+func newVariableValue(value interface{}, typ *ast.Type, types *variableTypes) (*structpb.Value, error) {
+	switch value := value.(type) {
+	case json.Number:
+		// Custom scalars (assumed when the type is unknown) take inexact integers as strings, builtin
+		// ones get numbers, the server rejecting or rounding them
+		asString := typ == nil || !builtinScalars[typ.Name()]
+
+		if integer, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			if asString && (integer > maxExactInteger || integer < -maxExactInteger) {
+				return structpb.NewStringValue(string(value)), nil
+			}
+
+			return structpb.NewNumberValue(float64(integer)), nil
+		}
+
+		if _, err := strconv.ParseUint(string(value), 10, 64); err == nil && asString {
+			return structpb.NewStringValue(string(value)), nil
+		}
+
+		number, err := value.Float64()
+		if err != nil || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("invalid number %s", value)
+		}
+
+		return structpb.NewNumberValue(number), nil
+	case []interface{}:
+		elementType := typ
+		if typ != nil && typ.Elem != nil {
+			elementType = typ.Elem
+		}
+
+		values := make([]*structpb.Value, len(value))
+		for i, element := range value {
+			converted, err := newVariableValue(element, elementType, types)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = converted
+		}
+
+		return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+	case map[string]interface{}:
+		fields := make(map[string]*structpb.Value, len(value))
+		for key, element := range value {
+			converted, err := newVariableValue(element, types.fieldType(typ, key), types)
+			if err != nil {
+				return nil, err
+			}
+
+			fields[key] = converted
+		}
+
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+	default:
+		// Remaining JSON values: nil, bool and string
+		return structpb.NewValue(value)
+	}
+}
@@ -0,0 +1,117 @@
+package dfuse
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	pbgraphql "github.com/streamingfast/pbgo/sf/graphql/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAmount uint64
+
+func (a testAmount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]uint64{"value": uint64(a)})
+}
+
+func TestGraphQLVariables_Encoding(t *testing.T) {
+	type filter struct {
+		Accounts []string  `json:"accounts"`
+		After    time.Time `json:"after"`
+		Limit    *int      `json:"limit,omitempty"`
+		internal string
+	}
+
+	limit := 10
+
+	tests := []struct {
+		name        string
+		options     []GraphQLOption
+		expected    string
+		expectedErr string
+	}{
+		{"no variables", nil, `{}`, ""},
+		{"primitives", []GraphQLOption{GraphQLVariables{"num": 10, "price": 1.5, "name": "eosio", "active": true, "none": nil}}, `{"active":true,"name":"eosio","none":null,"num":10,"price":1.5}`, ""},
+		{"big integers", []GraphQLOption{GraphQLVariables{"int64": int64(math.MaxInt64), "uint64": uint64(math.MaxUint64), "exact": int64(1 << 53), "negative": int64(-(1 << 53) - 1)}}, `{"exact":9007199254740992,"int64":"9223372036854775807","negative":"-9007199254740993","uint64":"18446744073709551615"}`, ""},
+		{"typed values", []GraphQLOption{GraphQLVariables{"accounts": []string{"a", "b"}, "at": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "amount": testAmount(math.MaxUint64)}}, `{"accounts":["a","b"],"amount":{"value":"18446744073709551615"},"at":"2020-01-02T03:04:05Z"}`, ""},
+		{"struct", []GraphQLOption{GraphQLVariablesOf(filter{Accounts: []string{"a"}, After: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), internal: "ignored"})}, `{"accounts":["a"],"after":"2020-01-02T00:00:00Z"}`, ""},
+		{"struct pointer merged", []GraphQLOption{GraphQLVariablesOf(&filter{Limit: &limit}), GraphQLVariables{"cursor": "abc"}}, `{"accounts":null,"after":"0001-01-01T00:00:00Z","cursor":"abc","limit":10}`, ""},
+		{"nil struct", []GraphQLOption{GraphQLVariablesOf((*filter)(nil))}, `{}`, ""},
+		{"map", []GraphQLOption{GraphQLVariablesOf(map[string]uint64{"num": math.MaxUint64})}, `{"num":"18446744073709551615"}`, ""},
+		{"not an object", []GraphQLOption{GraphQLVariablesOf([]string{"a"})}, "", "invalid variables: variables must encode to a JSON object: "},
+		{"not encodable", []GraphQLOption{GraphQLVariablesOf(map[string]interface{}{"ch": make(chan int)})}, "", "invalid variables: encode variables: json: unsupported type: chan int"},
+		{"invalid value", []GraphQLOption{GraphQLVariables{"ch": make(chan int)}}, "", "invalid variables: encode variables: json: unsupported type: chan int"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			client, err := NewClient("", "", WithoutAuthentication(), WithGraphQLTransport(transport))
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(context.Background(), "{ ping }", test.options...)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(transport.request.Variables.AsMap())
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(encoded))
+		})
+	}
+}
+
+func TestGraphQLVariables_EncodingDeclaredTypes(t *testing.T) {
+	schema, err := NewGraphQLSchemaFromSDL(`
+		scalar Uint64
+		input Filter { minimum: Float amount: Uint64 nested: [Filter!] }
+		type Query { ping(amount: Uint64, price: Float, prices: [Float!], filter: Filter): String }
+	`)
+	require.NoError(t, err)
+
+	big := int64(1 << 60)
+	filter := map[string]interface{}{"minimum": big, "amount": uint64(math.MaxUint64), "nested": []interface{}{map[string]interface{}{"minimum": big}}}
+
+	tests := []struct {
+		name      string
+		schema    *GraphQLSchema
+		document  string
+		variables GraphQLVariables
+		expected  string
+	}{
+		{"custom scalar", nil, "query ($amount: Uint64) { ping(amount: $amount) }", GraphQLVariables{"amount": uint64(math.MaxUint64)}, `{"amount":"18446744073709551615"}`},
+		{"builtin scalar", nil, "query ($price: Float) { ping(price: $price) }", GraphQLVariables{"price": big}, `{"price":1152921504606846976}`},
+		{"builtin scalar list", nil, "query ($prices: [Float!]) { ping(prices: $prices) }", GraphQLVariables{"prices": []int64{big}}, `{"prices":[1152921504606846976]}`},
+		{"undeclared", nil, "query ($price: Float) { ping(price: $price) }", GraphQLVariables{"price": big, "other": big}, `{"other":"1152921504606846976","price":1152921504606846976}`},
+		{"input fields without schema", nil, "query ($filter: Filter) { ping(filter: $filter) }", GraphQLVariables{"filter": filter}, `{"filter":{"amount":"18446744073709551615","minimum":"1152921504606846976","nested":[{"minimum":"1152921504606846976"}]}}`},
+		{"input fields with schema", schema, "query ($filter: Filter) { ping(filter: $filter) }", GraphQLVariables{"filter": filter}, `{"filter":{"amount":"18446744073709551615","minimum":1152921504606846976,"nested":[{"minimum":1152921504606846976}]}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &testTransport{responses: []*pbgraphql.Response{{Data: `{}`}}}
+			options := []ClientOption{WithoutAuthentication(), WithGraphQLTransport(transport)}
+			if test.schema != nil {
+				options = append(options, WithDocumentValidation(test.schema))
+			}
+
+			client, err := NewClient("", "", options...)
+			require.NoError(t, err)
+
+			_, err = client.GraphQLQuery(context.Background(), test.document, test.variables)
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(transport.request.Variables.AsMap())
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(encoded))
+		})
+	}
+}